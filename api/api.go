@@ -1,13 +1,19 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 )
 
 type API struct {
-	db *sql.DB
+	db    *sql.DB
+	cache permissionCache
 }
 
-func New(db *sql.DB) *API {
-	return &API{db}
+func New(ctx context.Context, db *sql.DB, databaseURL string) *API {
+	s := &API{db: db}
+
+	go s.invalidateCacheForever(ctx, databaseURL)
+
+	return s
 }
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// The cache is cleared rather than grown past this many entries.
+const maxCacheEntries = 10_000
+
+type cacheKey struct {
+	kthID  string
+	system string
+}
+
+type cacheEntry struct {
+	permissions []Permission
+	// The first time after which the result may change without any row changing, i.e. when one
+	// of the user's mandates, any permission grant or any subrole link starts or ends. Zero means never.
+	expiresAt time.Time
+}
+
+// A cache of resolved permissions per user and system. It is only enabled while the listener for
+// changes is connected, since changes may otherwise be missed.
+type permissionCache struct {
+	mu      sync.Mutex
+	enabled bool
+	entries map[cacheKey]cacheEntry
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// Returns the cached permissions for the key. The returned slice must not be modified.
+func (c *permissionCache) get(key cacheKey) ([]Permission, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && (entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt)) {
+		c.hits.Add(1)
+		return entry.permissions, true
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+// Stores permissions that were read after `generation` was returned. They are dropped if the
+// cache has been cleared since then, as they may be based on stale data.
+func (c *permissionCache) put(key cacheKey, entry cacheEntry, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled || generation != c.invalidations.Load() {
+		return
+	}
+	if len(c.entries) >= maxCacheEntries {
+		c.entries = make(map[cacheKey]cacheEntry)
+	}
+	c.entries[key] = entry
+}
+
+// Returns a value to pass to `put` for results read after this call.
+func (c *permissionCache) generation() uint64 {
+	return c.invalidations.Load()
+}
+
+func (c *permissionCache) clear(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = enabled
+	c.entries = make(map[cacheKey]cacheEntry)
+	c.invalidations.Add(1)
+}
+
+// Clears the permission cache whenever the database reports that roles, mandates or permissions
+// have changed. Runs until the context is cancelled.
+func (s *API) invalidateCacheForever(ctx context.Context, databaseURL string) {
+	listener := pq.NewListener(databaseURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventReconnected:
+			// The listener has already resumed listening on the channel when this is sent.
+			s.cache.clear(true)
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			s.cache.clear(false)
+			slog.Error("Lost connection for permission change notifications", "error", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen("permissions_changed"); err != nil {
+		slog.Error("Could not listen for permission changes, the cache is disabled", "error", err)
+		return
+	}
+	// Only enable the cache once changes are being listened for, so that none are missed.
+	s.cache.clear(true)
+	for {
+		select {
+		case <-listener.Notify:
+			// A nil notification is sent after reconnecting, which also warrants a clear.
+			s.cache.clear(true)
+		case <-time.After(5 * time.Minute):
+			go listener.Ping()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Writes cache metrics in the prometheus text format.
+func cacheMetrics(api *API, _ uuid.UUID, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE pls_permission_cache_hits_total counter\n")
+	fmt.Fprintf(w, "pls_permission_cache_hits_total %d\n", api.cache.hits.Load())
+	fmt.Fprintf(w, "# TYPE pls_permission_cache_misses_total counter\n")
+	fmt.Fprintf(w, "pls_permission_cache_misses_total %d\n", api.cache.misses.Load())
+	fmt.Fprintf(w, "# TYPE pls_permission_cache_invalidations_total counter\n")
+	fmt.Fprintf(w, "pls_permission_cache_invalidations_total %d\n", api.cache.invalidations.Load())
+	api.cache.mu.Lock()
+	entries := len(api.cache.entries)
+	api.cache.mu.Unlock()
+	fmt.Fprintf(w, "# TYPE pls_permission_cache_entries gauge\n")
+	fmt.Fprintf(w, "pls_permission_cache_entries %d\n", entries)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/datasektionen/pls4/models"
+	"github.com/lib/pq"
+)
+
+// Returns every way in which the user gets the permission, including through mandates or grants that
+// are not current. Active ones come first.
+func (s *API) UserExplainPermission(ctx context.Context, kthID, system, permission string) ([]models.PermissionGrant, error) {
+	if !systemRegex.MatchString(system) {
+		return nil, fmt.Errorf("Invalid system %v. Must match %v", system, systemRegex)
+	}
+	if !permissionRegex.MatchString(permission) {
+		return nil, fmt.Errorf("Invalid permission %v. Must match %v", permission, permissionRegex)
+	}
+	rows, err := s.db.QueryContext(ctx, `--sql
+		with recursive paths (member_id, path, links_active) as (
+			select id, array[role_id], true from roles_users
+			where kth_id = $1
+			union all
+			select
+				p.member_id, p.path || rr.superrole_id,
+				p.links_active
+					and now() >= coalesce(rr.start_date, '-infinity')
+					and now() <= coalesce(rr.end_date, 'infinity')
+			from paths p
+			inner join roles_roles rr
+				on rr.subrole_id = p.path[array_length(p.path, 1)]
+			where not rr.superrole_id = any(p.path)
+		)
+		select
+			m.id, m.kth_id, m.modified_by, m.modified_at, m.start_date, m.end_date,
+			now() between m.start_date and m.end_date
+				and p.links_active
+				and now() >= coalesce(rp.start_date, '-infinity')
+				and now() <= coalesce(rp.end_date, 'infinity') as active,
+			p.path, i.id, coalesce(i.scope, ''), rp.start_date, rp.end_date
+		from paths p
+		inner join roles_users m
+			on m.id = p.member_id
+		inner join roles_permissions rp
+			on rp.role_id = p.path[array_length(p.path, 1)]
+		inner join permission_instances i
+			on i.id = rp.permission_instance_id
+		where i.system_id = $2 and i.permission_id = $3
+		order by active desc, m.end_date desc, array_length(p.path, 1), p.path
+	`, kthID, system, permission)
+	if err != nil {
+		return nil, err
+	}
+	var grants []models.PermissionGrant
+	for rows.Next() {
+		var g models.PermissionGrant
+		var grantStart, grantEnd sql.NullTime
+		if err := rows.Scan(
+			&g.Mandate.MemberID, &g.Mandate.KTHID, &g.Mandate.ModifiedBy, &g.Mandate.ModifiedAt,
+			&g.Mandate.StartDate, &g.Mandate.EndDate,
+			&g.Active, pq.Array(&g.Roles), &g.InstanceID, &g.Scope,
+			&grantStart, &grantEnd,
+		); err != nil {
+			return nil, err
+		}
+		g.GrantStartDate = grantStart.Time
+		g.GrantEndDate = grantEnd.Time
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
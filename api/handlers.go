@@ -2,8 +2,12 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
@@ -16,21 +20,61 @@ type Permission struct {
 	Scopes       []string `json:"scopes,omitempty"`
 }
 
+// Returns the permissions the user currently has in the system. The result may come from a cache
+// and must not be modified.
 func (s *API) UserGetPermissions(ctx context.Context, kthID, system string) ([]Permission, error) {
 	if !systemRegex.MatchString(system) {
 		return nil, fmt.Errorf("Invalid permission %v. Must match %v", system, systemRegex)
 	}
+	key := cacheKey{kthID, system}
+	if permissions, ok := s.cache.get(key); ok {
+		return permissions, nil
+	}
+	generation := s.cache.generation()
+	var expiresAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, `--sql
+		select min(boundary)::timestamptz from (
+			select start_date as boundary from roles_users
+			where kth_id = $1 and start_date > now()
+			union all
+			select end_date from roles_users
+			where kth_id = $1 and end_date > now()
+			union all
+			select start_date from roles_permissions
+			where start_date > now()
+			union all
+			select end_date from roles_permissions
+			where end_date > now()
+			union all
+			select start_date from roles_roles
+			where start_date > now()
+			union all
+			select end_date from roles_roles
+			where end_date > now()
+		) b
+	`, kthID).Scan(&expiresAt); err != nil {
+		return nil, err
+	}
+	permissions, err := s.userGetPermissions(ctx, kthID, system)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(key, cacheEntry{permissions, expiresAt.Time}, generation)
+	return permissions, nil
+}
+
+func (s *API) userGetPermissions(ctx context.Context, kthID, system string) ([]Permission, error) {
 	rows, err := s.db.QueryContext(ctx, `--sql
 		with recursive all_roles (role_id) as (
 			select role_id from roles_users
 			where kth_id = $1 and now() between start_date and end_date
 			union
 			select superrole_id from all_roles
-			inner join roles_roles
+			inner join current_roles_roles
 				on subrole_id = role_id
 		)
 		select permission_id, coalesce(scope, '') from all_roles a
-		inner join roles_permissions p
+		inner join current_roles_permissions p
 			using (role_id)
 		inner join permission_instances i
 			on i.id = p.permission_instance_id
@@ -40,6 +84,51 @@ func (s *API) UserGetPermissions(ctx context.Context, kthID, system string) ([]P
 	if err != nil {
 		return nil, err
 	}
+	return scanPermissions(rows)
+}
+
+func (s *API) TokenGetPermissions(ctx context.Context, tokenID uuid.UUID, system string) ([]Permission, error) {
+	if !systemRegex.MatchString(system) {
+		return nil, fmt.Errorf("Invalid permission %v. Must match %v", system, systemRegex)
+	}
+	rows, err := s.db.QueryContext(ctx, `--sql
+		select permission_id, coalesce(scope, '')
+		from api_tokens_permissions p
+		inner join permission_instances i
+			on i.id = p.permission_instance_id
+		where p.api_token_id = $1
+		and i.system_id = $2
+		order by permission_id
+	`, tokenID, system)
+	if err != nil {
+		return nil, err
+	}
+	return scanPermissions(rows)
+}
+
+func (s *API) TokenCheckPermission(ctx context.Context, tokenID uuid.UUID, system string, permission string) (bool, error) {
+	scopes, err := s.TokenGetScopes(ctx, tokenID, system, permission)
+	return scopes != nil, err
+}
+
+func (s *API) TokenGetScopes(ctx context.Context, tokenID uuid.UUID, system string, permission string) ([]string, error) {
+	if !permissionRegex.MatchString(permission) {
+		return nil, fmt.Errorf("Invalid permission %v. Must match %v", permission, permissionRegex)
+	}
+	permissions, err := s.TokenGetPermissions(ctx, tokenID, system)
+	if err != nil {
+		return nil, err
+	}
+	for _, perm := range permissions {
+		if permission == perm.PermissionID {
+			return perm.Scopes, nil
+		}
+	}
+	return nil, nil
+}
+
+// Groups rows of (permission_id, scope), ordered by permission_id, into permissions.
+func scanPermissions(rows *sql.Rows) ([]Permission, error) {
 	perms := make([]Permission, 1)
 	p := &perms[0]
 	for rows.Next() {
@@ -78,6 +167,72 @@ func (s *API) UserCheckPermission(ctx context.Context, kthID, system string, per
 	return false, nil
 }
 
+type PermissionCheck struct {
+	System     string `json:"system"`
+	Permission string `json:"permission"`
+}
+
+// Checks every permission for every user. The result is indexed first by user and then by
+// permission, in the order they were given.
+func (s *API) UsersCheckPermissions(ctx context.Context, kthIDs []string, checks []PermissionCheck) ([][]bool, error) {
+	systems := make([]string, len(checks))
+	permissions := make([]string, len(checks))
+	for i, check := range checks {
+		if !systemRegex.MatchString(check.System) {
+			return nil, fmt.Errorf("Invalid system %v. Must match %v", check.System, systemRegex)
+		}
+		if !permissionRegex.MatchString(check.Permission) {
+			return nil, fmt.Errorf("Invalid permission %v. Must match %v", check.Permission, permissionRegex)
+		}
+		systems[i] = check.System
+		permissions[i] = check.Permission
+	}
+	rows, err := s.db.QueryContext(ctx, `--sql
+		with recursive all_roles (kth_id, role_id) as (
+			select kth_id, role_id from roles_users
+			where kth_id = any($1) and now() between start_date and end_date
+			union
+			select kth_id, superrole_id from all_roles
+			inner join current_roles_roles
+				on subrole_id = role_id
+		)
+		select distinct a.kth_id, i.system_id, i.permission_id
+		from all_roles a
+		inner join current_roles_permissions p
+			using (role_id)
+		inner join permission_instances i
+			on i.id = p.permission_instance_id
+		inner join unnest($2::text[], $3::text[]) c (system_id, permission_id)
+			on c.system_id = i.system_id and c.permission_id = i.permission_id
+	`, pq.Array(kthIDs), pq.Array(systems), pq.Array(permissions))
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[string]map[PermissionCheck]struct{})
+	for rows.Next() {
+		var kthID string
+		var check PermissionCheck
+		if err := rows.Scan(&kthID, &check.System, &check.Permission); err != nil {
+			return nil, err
+		}
+		if granted[kthID] == nil {
+			granted[kthID] = make(map[PermissionCheck]struct{})
+		}
+		granted[kthID][check] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result := make([][]bool, len(kthIDs))
+	for i, kthID := range kthIDs {
+		result[i] = make([]bool, len(checks))
+		for j, check := range checks {
+			_, result[i][j] = granted[kthID][check]
+		}
+	}
+	return result, nil
+}
+
 func (s *API) UserGetScopes(ctx context.Context, kthID, system string, permission string) ([]string, error) {
 	if !systemRegex.MatchString(system) {
 		return nil, fmt.Errorf("Invalid permission %v. Must match %v", system, systemRegex)
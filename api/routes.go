@@ -4,21 +4,33 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+
+	"github.com/datasektionen/pls4/models"
+	"github.com/google/uuid"
 )
 
 func Mount(mux *http.ServeMux, api *API) {
 	mux.Handle("/api/user/get-permissions", route(api, userGetPermissions))
 	mux.Handle("/api/user/check", route(api, userCheckPermission))
 	mux.Handle("/api/user/get-scopes", route(api, userGetScopes))
+	mux.Handle("/api/user/check-many", route(api, userCheckMany))
+	mux.Handle("/api/user/check-scope", route(api, userCheckScope))
+	mux.Handle("/api/user/explain", route(api, userExplain))
+	mux.Handle("/api/token/get-permissions", route(api, tokenGetPermissions))
+	mux.Handle("GET /metrics", route(api, cacheMetrics))
 }
 
-func route(api *API, handler func(api *API, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+func route(api *API, handler func(api *API, tokenID uuid.UUID, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		handler(api, w, r)
+		tokenID, ok := api.Authenticate(w, r)
+		if !ok {
+			return
+		}
+		handler(api, tokenID, w, r)
 	}
 }
 
-func userGetPermissions(api *API, w http.ResponseWriter, r *http.Request) {
+func userGetPermissions(api *API, _ uuid.UUID, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var body struct {
 		KTHID  string `json:"kth_id"`
@@ -41,7 +53,7 @@ func userGetPermissions(api *API, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func userCheckPermission(api *API, w http.ResponseWriter, r *http.Request) {
+func userCheckPermission(api *API, _ uuid.UUID, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var body struct {
 		KTHID      string `json:"kth_id"`
@@ -65,7 +77,82 @@ func userCheckPermission(api *API, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func userGetScopes(api *API, w http.ResponseWriter, r *http.Request) {
+func userCheckMany(api *API, _ uuid.UUID, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var body struct {
+		KTHIDs      []string          `json:"kth_ids"`
+		Permissions []PermissionCheck `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	matrix, err := api.UsersCheckPermissions(ctx, body.KTHIDs, body.Permissions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error checking user permissions", "error", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(matrix); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error writing body", "error", err)
+		return
+	}
+}
+
+func userCheckScope(api *API, _ uuid.UUID, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var body struct {
+		KTHID      string `json:"kth_id"`
+		System     string `json:"system"`
+		Permission string `json:"permission"`
+		Scope      string `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ok, err := api.UserCheckScope(ctx, body.KTHID, body.System, body.Permission, body.Scope)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error checking user scope", "error", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(ok); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error writing body", "error", err)
+		return
+	}
+}
+
+func userExplain(api *API, _ uuid.UUID, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var body struct {
+		KTHID      string `json:"kth_id"`
+		System     string `json:"system"`
+		Permission string `json:"permission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	grants, err := api.UserExplainPermission(ctx, body.KTHID, body.System, body.Permission)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error explaining user permission", "error", err)
+		return
+	}
+	if grants == nil {
+		grants = []models.PermissionGrant{}
+	}
+	if err := json.NewEncoder(w).Encode(grants); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error writing body", "error", err)
+		return
+	}
+}
+
+func userGetScopes(api *API, _ uuid.UUID, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var body struct {
 		KTHID      string `json:"kth_id"`
@@ -88,3 +175,25 @@ func userGetScopes(api *API, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func tokenGetPermissions(api *API, tokenID uuid.UUID, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var body struct {
+		System string `json:"system"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	permissions, err := api.TokenGetPermissions(ctx, tokenID, body.System)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error getting token permissions", "error", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(permissions); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error writing body", "error", err)
+		return
+	}
+}
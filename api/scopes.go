@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"slices"
+)
+
+// Reports whether a granted scope covers the requested scope. In the granted scope `*` matches any
+// sequence of characters, including none and including `/`, so `*` covers everything and
+// `nämnd/*` covers `nämnd/dsys` and `nämnd/dsys/cashflow` but not `nämnd`. All other characters
+// must match exactly.
+func ScopeMatches(granted, requested string) bool {
+	// Position in `granted` just after the last star, and in `requested` where that star's match
+	// would end if it is extended by one character.
+	star, next := -1, 0
+	g, r := 0, 0
+	for r < len(requested) {
+		if g < len(granted) && granted[g] == '*' {
+			star, next = g+1, r
+			g++
+		} else if g < len(granted) && granted[g] == requested[r] {
+			g++
+			r++
+		} else if star != -1 {
+			next++
+			g, r = star, next
+		} else {
+			return false
+		}
+	}
+	for g < len(granted) && granted[g] == '*' {
+		g++
+	}
+	return g == len(granted)
+}
+
+// Reports whether any of the scopes covers the requested scope.
+func AnyScopeMatches(scopes []string, requested string) bool {
+	return slices.ContainsFunc(scopes, func(granted string) bool {
+		return ScopeMatches(granted, requested)
+	})
+}
+
+// Reports whether the user has the permission with a scope covering the requested scope.
+func (s *API) UserCheckScope(ctx context.Context, kthID, system, permission, scope string) (bool, error) {
+	scopes, err := s.UserGetScopes(ctx, kthID, system, permission)
+	if err != nil {
+		return false, err
+	}
+	return AnyScopeMatches(scopes, scope), nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import "testing"
+
+func TestScopeMatches(t *testing.T) {
+	tests := []struct {
+		granted, requested string
+		want               bool
+	}{
+		{"dsys", "dsys", true},
+		{"dsys", "dsy", false},
+		{"dsys", "dsyss", false},
+		{"", "", true},
+		{"", "dsys", false},
+		{"*", "", true},
+		{"*", "dsys", true},
+		{"*", "nämnd/dsys/cashflow", true},
+		{"**", "dsys", true},
+		{"nämnd/*", "nämnd/dsys", true},
+		{"nämnd/*", "nämnd/dsys/cashflow", true},
+		{"nämnd/*", "nämnd/", true},
+		{"nämnd/*", "nämnd", false},
+		{"nämnd/*", "sektion/nämnd/dsys", false},
+		{"*/dsys", "nämnd/dsys", true},
+		{"*/dsys", "nämnd/dsys/cashflow", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "abcbc", true},
+		{"a*b*c", "acb", false},
+		{"a*a", "aaa", true},
+		{"a*a", "ab", false},
+		{"dsys", "*", false},
+	}
+	for _, test := range tests {
+		if got := ScopeMatches(test.granted, test.requested); got != test.want {
+			t.Errorf("ScopeMatches(%q, %q) = %v, want %v", test.granted, test.requested, got, test.want)
+		}
+	}
+}
+
+func TestAnyScopeMatches(t *testing.T) {
+	tests := []struct {
+		scopes    []string
+		requested string
+		want      bool
+	}{
+		{nil, "dsys", false},
+		{[]string{}, "", false},
+		{[]string{"drek", "dsys"}, "dsys", true},
+		{[]string{"drek", "nämnd/*"}, "nämnd/dsys", true},
+		{[]string{"drek", "nämnd/*"}, "dsys", false},
+	}
+	for _, test := range tests {
+		if got := AnyScopeMatches(test.scopes, test.requested); got != test.want {
+			t.Errorf("AnyScopeMatches(%q, %q) = %v, want %v", test.scopes, test.requested, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Returns the id of the api token with the given secret and marks it as used, or uuid.Nil if
+// there is no such token or if it has expired.
+func (s *API) ValidateToken(ctx context.Context, secret uuid.UUID) (uuid.UUID, error) {
+	var id uuid.UUID
+	if err := s.db.QueryRowContext(ctx, `--sql
+		update api_tokens
+		set last_used_at = now()
+		where secret = $1
+		and (expires_at is null or expires_at > now())
+		returning id
+	`, secret).Scan(&id); err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	} else if err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// Checks the bearer token of the request and returns the id of the token. If the token is
+// missing or invalid an error response is written and false is returned.
+func (s *API) Authenticate(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	ctx := r.Context()
+	secret := bearerToken(r)
+	if secret == uuid.Nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+	tokenID, err := s.ValidateToken(ctx, secret)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error validating api token", "error", err)
+		return uuid.Nil, false
+	}
+	if tokenID == uuid.Nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+	return tokenID, true
+}
+
+// Returns the secret from the `Authorization: Bearer <secret>` header, or uuid.Nil if it is
+// missing or malformed.
+func bearerToken(r *http.Request) uuid.UUID {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return uuid.Nil
+	}
+	secret, err := uuid.Parse(strings.TrimSpace(token))
+	if err != nil {
+		return uuid.Nil
+	}
+	return secret
+}
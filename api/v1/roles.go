@@ -0,0 +1,232 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/google/uuid"
+)
+
+func listRoles(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	roles, err := ui.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(roles), nil
+}
+
+func getHierarchy(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	return ui.GetRoleHierarchy(ctx)
+}
+
+func getRole(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	return ui.GetRole(ctx, r.PathValue("id"))
+}
+
+func createRole(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	var body struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+		Description string `json:"description"`
+		Owner       string `json:"owner"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	if err := ui.CreateRole(ctx, actor, body.ID, body.DisplayName, body.Description, body.Owner); err != nil {
+		return nil, err
+	}
+	return ui.GetRole(ctx, body.ID)
+}
+
+func updateRole(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	roleID := r.PathValue("id")
+	var body struct {
+		DisplayName string `json:"display_name"`
+		Description string `json:"description"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	if err := ui.UpdateRole(ctx, actor, roleID, body.DisplayName, body.Description); err != nil {
+		return nil, err
+	}
+	return ui.GetRole(ctx, roleID)
+}
+
+func deleteRole(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	return nil, ui.DeleteRole(ctx, actor, r.PathValue("id"))
+}
+
+func getMembers(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	query := r.URL.Query()
+	period, err := service.ParseMemberPeriod(query.Get("period"))
+	if err != nil {
+		return nil, err
+	}
+	members, err := ui.GetRoleMembers(ctx, r.PathValue("id"), period, query.Has("include-indirect"))
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(members), nil
+}
+
+func getMandates(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	period, err := service.ParseMemberPeriod(r.URL.Query().Get("period"))
+	if err != nil {
+		return nil, err
+	}
+	mandates, err := ui.GetAllMandates(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(mandates), nil
+}
+
+func addMember(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	var body struct {
+		KTHID     string `json:"kth_id"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	startDate, err := parseDate("start_date", body.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	endDate, err := parseDate("end_date", body.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	id, err := ui.AddMember(ctx, actor, r.PathValue("id"), body.KTHID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]uuid.UUID{"id": id}, nil
+}
+
+func updateMember(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	memberID, err := uuid.Parse(r.PathValue("memberID"))
+	if err != nil {
+		return nil, badRequest("Invalid syntax for member uuid")
+	}
+	var body struct {
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	startDate, err := parseDate("start_date", body.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	endDate, err := parseDate("end_date", body.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	return nil, ui.UpdateMember(ctx, actor, r.PathValue("id"), memberID, startDate, endDate)
+}
+
+func removeMember(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	memberID, err := uuid.Parse(r.PathValue("memberID"))
+	if err != nil {
+		return nil, badRequest("Invalid syntax for member uuid")
+	}
+	return nil, ui.RemoveMember(ctx, actor, r.PathValue("id"), memberID)
+}
+
+func renewMembers(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	var body struct {
+		EndDate         string      `json:"end_date"`
+		NextEndDate     string      `json:"next_end_date"`
+		IncludeSubroles bool        `json:"include_subroles"`
+		Renew           []uuid.UUID `json:"renew"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	endDate, err := parseDate("end_date", body.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	nextEndDate, err := parseDate("next_end_date", body.NextEndDate)
+	if err != nil {
+		return nil, err
+	}
+	renewed, err := ui.RenewMandates(ctx, actor, r.PathValue("id"), body.IncludeSubroles, endDate, nextEndDate, body.Renew)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"renewed": renewed}, nil
+}
+
+func getSubroles(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	subroles, err := ui.GetSubroles(ctx, r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(subroles), nil
+}
+
+func getSuperroles(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	superroles, err := ui.GetSuperroles(ctx, r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(superroles), nil
+}
+
+func addSubrole(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	var body struct {
+		SubroleID string `json:"subrole_id"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	startDate, err := parseDate("start_date", body.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	endDate, err := parseDate("end_date", body.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	return nil, ui.AddSubrole(ctx, actor, r.PathValue("id"), body.SubroleID, startDate, endDate)
+}
+
+func updateSubrole(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	var body struct {
+		StartDate optionalDate `json:"start_date"`
+		EndDate   optionalDate `json:"end_date"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	startDate, err := parseOptionalDate("start_date", body.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	endDate, err := parseOptionalDate("end_date", body.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	return nil, ui.UpdateSubroleDates(ctx, actor, r.PathValue("id"), r.PathValue("subroleID"), startDate, endDate)
+}
+
+func removeSubrole(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	return nil, ui.RemoveSubrole(ctx, actor, r.PathValue("id"), r.PathValue("subroleID"))
+}
+
+// Makes sure empty lists are encoded as `[]` rather than `null`.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/datasektionen/pls4/api"
+	"github.com/datasektionen/pls4/ui/service"
+)
+
+func Mount(mux *http.ServeMux, api *api.API, ui *service.UI) {
+	mux.Handle("GET /api/v1/roles", route(api, ui, listRoles))
+	mux.Handle("POST /api/v1/roles", route(api, ui, createRole))
+	mux.Handle("GET /api/v1/roles/{id}", route(api, ui, getRole))
+	mux.Handle("PATCH /api/v1/roles/{id}", route(api, ui, updateRole))
+	mux.Handle("DELETE /api/v1/roles/{id}", route(api, ui, deleteRole))
+
+	mux.Handle("GET /api/v1/roles/{id}/members", route(api, ui, getMembers))
+	mux.Handle("POST /api/v1/roles/{id}/members", route(api, ui, addMember))
+	mux.Handle("PATCH /api/v1/roles/{id}/members/{memberID}", route(api, ui, updateMember))
+	mux.Handle("DELETE /api/v1/roles/{id}/members/{memberID}", route(api, ui, removeMember))
+	mux.Handle("POST /api/v1/roles/{id}/renew", route(api, ui, renewMembers))
+
+	mux.Handle("GET /api/v1/roles/{id}/subroles", route(api, ui, getSubroles))
+	mux.Handle("POST /api/v1/roles/{id}/subroles", route(api, ui, addSubrole))
+	mux.Handle("PATCH /api/v1/roles/{id}/subroles/{subroleID}", route(api, ui, updateSubrole))
+	mux.Handle("DELETE /api/v1/roles/{id}/subroles/{subroleID}", route(api, ui, removeSubrole))
+	mux.Handle("GET /api/v1/roles/{id}/superroles", route(api, ui, getSuperroles))
+
+	mux.Handle("GET /api/v1/hierarchy", route(api, ui, getHierarchy))
+	mux.Handle("GET /api/v1/mandates", route(api, ui, getMandates))
+
+	mux.Handle("GET /api/v1/systems", route(api, ui, listSystems))
+	mux.Handle("GET /api/v1/systems/{id}/permissions", route(api, ui, getPermissions))
+	mux.Handle("POST /api/v1/systems/{id}/permissions", route(api, ui, createPermission))
+	mux.Handle("DELETE /api/v1/systems/{id}/permissions/{permissionID}", route(api, ui, deletePermission))
+	mux.Handle("PUT /api/v1/systems/{id}/permissions/{permissionID}/scope", route(api, ui, addScopeToPermission))
+	mux.Handle("DELETE /api/v1/systems/{id}/permissions/{permissionID}/scope", route(api, ui, removeScopeFromPermission))
+	mux.Handle("PUT /api/v1/systems/{id}/manifest", route(api, ui, syncManifest))
+}
+
+// A handler returns the value to respond with, which is encoded as json, or an error. A nil value
+// gives an empty response.
+type handler func(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error)
+
+// Errors with a message that is meant to be shown to the client.
+type badRequest string
+
+func (e badRequest) Error() string {
+	return string(e)
+}
+
+var statusCodes = map[service.ErrorKind]int{
+	service.Forbidden: http.StatusForbidden,
+	service.NotFound:  http.StatusNotFound,
+	service.Conflict:  http.StatusConflict,
+	service.Invalid:   http.StatusBadRequest,
+}
+
+func route(api *api.API, ui *service.UI, handler handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tokenID, ok := api.Authenticate(w, r)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := handler(ui, ctx, service.TokenActor(tokenID), r)
+		var serviceError *service.Error
+		var badRequestError badRequest
+		if errors.As(err, &serviceError) {
+			writeJSON(ctx, w, statusCodes[serviceError.Kind], map[string]string{"error": serviceError.Message})
+			return
+		} else if errors.As(err, &badRequestError) {
+			writeJSON(ctx, w, http.StatusBadRequest, map[string]string{"error": badRequestError.Error()})
+			return
+		} else if err != nil {
+			slog.ErrorContext(ctx, "Request failed", "error", err, "method", r.Method, "path", r.URL.Path)
+			writeJSON(ctx, w, http.StatusInternalServerError, map[string]string{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		if res == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		writeJSON(ctx, w, status, res)
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.ErrorContext(ctx, "Error writing body", "error", err)
+	}
+}
+
+func decodeBody(r *http.Request, body any) error {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		return badRequest("Invalid json body: " + err.Error())
+	}
+	return nil
+}
+
+// Parses a date on the form YYYY-MM-DD. An empty string gives the zero time.
+func parseDate(field, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, badRequest("Invalid syntax for " + field + ", expected YYYY-MM-DD")
+	}
+	return date, nil
+}
+
+// A date in a request body where an omitted field can be told apart from an explicit `null`.
+type optionalDate struct {
+	set   bool
+	value string
+}
+
+func (d *optionalDate) UnmarshalJSON(b []byte) error {
+	d.set = true
+	if string(b) == "null" {
+		d.value = ""
+		return nil
+	}
+	return json.Unmarshal(b, &d.value)
+}
+
+// Parses an optional date. Returns nil if it was omitted, and the zero time if it was `null`.
+func parseOptionalDate(field string, d optionalDate) (*time.Time, error) {
+	if !d.set {
+		return nil, nil
+	}
+	date, err := parseDate(field, d.value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/datasektionen/pls4/models"
+	"github.com/datasektionen/pls4/ui/service"
+)
+
+func listSystems(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	systems, err := ui.GetAllSystems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(systems), nil
+}
+
+func getPermissions(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	permissions, err := ui.GetPermissions(ctx, r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(permissions), nil
+}
+
+func createPermission(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	var body models.Permission
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	if err := ui.CreatePermission(ctx, r.PathValue("id"), body.ID, body.HasScope, actor); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func deletePermission(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	return nil, ui.DeletePermission(ctx, r.PathValue("id"), r.PathValue("permissionID"), actor)
+}
+
+func addScopeToPermission(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	var body struct {
+		DefaultScope string `json:"default_scope"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	return nil, ui.AddScopeToPermission(ctx, r.PathValue("id"), r.PathValue("permissionID"), body.DefaultScope, actor)
+}
+
+func removeScopeFromPermission(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	return nil, ui.RemoveScopeFromPermission(ctx, r.PathValue("id"), r.PathValue("permissionID"), actor)
+}
+
+func syncManifest(ui *service.UI, ctx context.Context, actor string, r *http.Request) (any, error) {
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		return nil, badRequest("Manifests must be sent as json")
+	}
+	var manifest models.Manifest
+	if err := decodeBody(r, &manifest); err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	dryRun := query.Has("dry-run")
+	changes, err := ui.SyncPermissions(ctx, actor, r.PathValue("id"), manifest, query.Has("prune"), dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"applied": !dryRun,
+		"changes": changes,
+	}, nil
+}
@@ -0,0 +1,2 @@
+insert into permissions (system_id, id, has_scope) values
+    ('pls', 'manage-api-tokens', false);
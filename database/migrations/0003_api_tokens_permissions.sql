@@ -0,0 +1,3 @@
+alter table api_tokens_permissions
+    drop constraint api_tokens_permissions_permission_instance_id_fkey,
+    add foreign key (permission_instance_id) references permission_instances (id) on delete cascade;
@@ -0,0 +1,24 @@
+create table audit_log (
+    id         bigint    generated always as identity primary key,
+    created_at timestamp not null default now(),
+    actor      text      not null,
+    action     text      not null,
+    role_id    text,
+    system_id  text,
+    target     text      not null,
+    before     jsonb,
+    after      jsonb
+);
+
+create index on audit_log (role_id, id);
+create index on audit_log (system_id, id);
+
+create function audit_log_append_only() returns trigger as $$
+begin
+    raise exception 'audit_log is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_log_append_only
+    before update or delete on audit_log
+    for each row execute function audit_log_append_only();
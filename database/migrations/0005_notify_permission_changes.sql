@@ -0,0 +1,24 @@
+-- Lets the api know when its cache of resolved permissions may be stale. Notifications with the
+-- same payload are only delivered once per transaction, so this is cheap for bulk changes.
+create function notify_permissions_changed() returns trigger as $$
+begin
+    perform pg_notify('permissions_changed', '');
+    return null;
+end;
+$$ language plpgsql;
+
+create trigger notify_permissions_changed
+    after insert or update or delete or truncate on roles_users
+    for each statement execute function notify_permissions_changed();
+
+create trigger notify_permissions_changed
+    after insert or update or delete or truncate on roles_roles
+    for each statement execute function notify_permissions_changed();
+
+create trigger notify_permissions_changed
+    after insert or update or delete or truncate on roles_permissions
+    for each statement execute function notify_permissions_changed();
+
+create trigger notify_permissions_changed
+    after insert or update or delete or truncate on permission_instances
+    for each statement execute function notify_permissions_changed();
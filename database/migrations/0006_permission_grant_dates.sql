@@ -0,0 +1,11 @@
+alter table roles_permissions
+    add column start_date date,
+    add column end_date   date,
+    add check (start_date <= end_date);
+
+-- The grants that are in effect right now, with the same bounds as mandates. A grant without a
+-- start or end date is unbounded in that direction.
+create view current_roles_permissions as
+select * from roles_permissions
+where now() >= coalesce(start_date, '-infinity')
+and now() <= coalesce(end_date, 'infinity');
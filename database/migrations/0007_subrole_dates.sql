@@ -0,0 +1,10 @@
+alter table roles_roles
+    add column start_date date,
+    add column end_date   date,
+    add check (start_date <= end_date);
+
+-- The subrole links that are in effect right now, see `current_roles_permissions`.
+create view current_roles_roles as
+select * from roles_roles
+where now() >= coalesce(start_date, '-infinity')
+and now() <= coalesce(end_date, 'infinity');
@@ -0,0 +1,13 @@
+alter table roles
+    add column notify_expiry bool not null default true;
+
+-- Mandates whose members have been notified that they are about to end. A mandate is notified
+-- again if its end date is changed.
+create table expiry_notifications (
+    member_id uuid      not null,
+    end_date  date      not null,
+    sent_at   timestamp not null default now(),
+
+    foreign key (member_id) references roles_users (id) on delete cascade,
+    primary key (member_id, end_date)
+);
@@ -0,0 +1,40 @@
+insert into permissions (system_id, id, has_scope) values
+    ('pls', 'manage-webhooks', false);
+
+create table webhooks (
+    id          uuid      primary key default gen_random_uuid(),
+    url         text      not null,
+    secret      uuid      not null default gen_random_uuid(),
+    description text      not null,
+    events      text[]    not null,
+    created_at  timestamp not null default now()
+);
+
+-- Events to send to webhooks, which are kept as a log after they have been delivered.
+create table webhook_deliveries (
+    id              bigint    generated always as identity primary key,
+    webhook_id      uuid      not null,
+    event           text      not null,
+    payload         jsonb     not null,
+    created_at      timestamp not null default now(),
+    attempts        int       not null default 0,
+    next_attempt_at timestamp not null default now(),
+    delivered_at    timestamp,
+    last_status     int,
+    last_error      text,
+
+    foreign key (webhook_id) references webhooks (id) on delete cascade
+);
+
+create index on webhook_deliveries (next_attempt_at) where delivered_at is null;
+create index on webhook_deliveries (webhook_id, id);
+
+-- Mandates that have been reported to webhooks as started or ended on the given date.
+create table webhook_mandate_events (
+    member_id uuid not null,
+    event     text not null,
+    date      date not null,
+
+    foreign key (member_id) references roles_users (id) on delete cascade,
+    primary key (member_id, event, date)
+);
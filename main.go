@@ -8,11 +8,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/datasektionen/pls4/api"
+	apiV1 "github.com/datasektionen/pls4/api/v1"
 	"github.com/datasektionen/pls4/database"
 	uiService "github.com/datasektionen/pls4/ui/service"
 	uiViews "github.com/datasektionen/pls4/ui/views"
@@ -24,6 +26,11 @@ func main() {
 	loginAPIURL := getenv("LOGIN_API_URL")
 	loginAPIKey := getenv("LOGIN_API_KEY") // "API token for login. Funnily enough this service verifies the token",
 	databaseURL := getenv("DATABASE_URL")
+	notifier := expiryNotifier(getenv("EXPIRY_NOTIFIER", "log"))
+	expiryNoticeDays, err := strconv.Atoi(getenv("EXPIRY_NOTICE_DAYS", "14"))
+	if err != nil {
+		panic("Invalid $EXPIRY_NOTICE_DAYS: " + err.Error())
+	}
 
 	db, err := sql.Open("postgres", databaseURL)
 	if err != nil {
@@ -40,16 +47,17 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	apiService := api.New(db)
-	uiService := uiService.New(ctx, db, apiService, loginFrontendURL, loginAPIURL, loginAPIKey)
+	apiService := api.New(ctx, db, databaseURL)
+	uiService := uiService.New(ctx, db, apiService, loginFrontendURL, loginAPIURL, loginAPIKey, notifier, expiryNoticeDays)
 
 	mux := http.NewServeMux()
 	api.Mount(mux, apiService)
+	apiV1.Mount(mux, apiService, uiService)
 	uiViews.Mount(mux, uiService)
 
 	server := http.Server{Addr: address, Handler: mux}
 
-	beginShutdown := make(chan os.Signal)
+	beginShutdown := make(chan os.Signal, 1)
 	signal.Notify(beginShutdown, os.Interrupt)
 	shutdownComplete := make(chan struct{})
 	go func() {
@@ -81,3 +89,26 @@ func getenv(key string, fallback ...string) string {
 	}
 	return value
 }
+
+// Returns where to send notifications about mandates that are about to end, or nil if they should
+// not be sent.
+func expiryNotifier(kind string) uiService.Notifier {
+	switch kind {
+	case "none":
+		return nil
+	case "log":
+		return uiService.LogNotifier{}
+	case "smtp":
+		return uiService.SMTPNotifier{
+			Address:     getenv("SMTP_ADDRESS"),
+			From:        getenv("SMTP_FROM"),
+			Username:    getenv("SMTP_USERNAME", ""),
+			Password:    getenv("SMTP_PASSWORD", ""),
+			EmailDomain: getenv("EMAIL_DOMAIN", "kth.se"),
+		}
+	case "webhook":
+		return uiService.WebhookNotifier{URL: getenv("EXPIRY_WEBHOOK_URL")}
+	default:
+		panic("Unknown $EXPIRY_NOTIFIER " + kind + ". Must be one of none, log, smtp or webhook.")
+	}
+}
@@ -7,20 +7,48 @@ import (
 )
 
 type Role struct {
-	ID           string
-	DisplayName  string
-	Description  string
-	SubroleCount int
-	MemberCount  int
+	ID           string `json:"id"`
+	DisplayName  string `json:"display_name"`
+	Description  string `json:"description"`
+	SubroleCount int    `json:"subrole_count"`
+	MemberCount  int    `json:"member_count"`
+}
+
+// A role linked as a sub- or superrole of another, with when the link is in effect. Zero dates
+// mean unbounded.
+type LinkedRole struct {
+	Role
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
 }
 
 type Member struct {
-	MemberID   uuid.UUID
-	KTHID      string
-	ModifiedBy string
-	ModifiedAt time.Time
-	StartDate  time.Time
-	EndDate    time.Time
+	MemberID   uuid.UUID `json:"id"`
+	KTHID      string    `json:"kth_id"`
+	ModifiedBy string    `json:"modified_by"`
+	ModifiedAt time.Time `json:"modified_at"`
+	StartDate  time.Time `json:"start_date"`
+	EndDate    time.Time `json:"end_date"`
+	// For indirect members, the sub-roles they are members through.
+	Via []string `json:"via,omitempty"`
+}
+
+// A mandate of a user, i.e. a membership seen from the member's side.
+type Mandate struct {
+	Member
+	RoleID          string `json:"role_id"`
+	RoleDisplayName string `json:"role_display_name"`
+}
+
+// All roles and the links between them.
+type RoleHierarchy struct {
+	Roles []Role        `json:"roles"`
+	Links []SubroleLink `json:"links"`
+}
+
+type SubroleLink struct {
+	SuperroleID string `json:"superrole_id"`
+	SubroleID   string `json:"subrole_id"`
 }
 
 type SystemPermissionInstances struct {
@@ -32,9 +60,126 @@ type PermissionInstance struct {
 	ID           uuid.UUID
 	PermissionID string
 	Scope        string
+	// When the role holding the instance has it. Zero means unbounded, which is always the case
+	// for instances held by api tokens.
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// A permission instance together with its system and the role holding it, if any.
+type HeldPermissionInstance struct {
+	PermissionInstance
+	SystemID string
+	RoleID   string
 }
 
 type Permission struct {
-	ID       string
-	HasScope bool
+	ID       string `json:"id"`
+	HasScope bool   `json:"has_scope"`
+}
+
+type APIToken struct {
+	ID          uuid.UUID
+	Description string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LastUsedAt  time.Time
+}
+
+// A subscription to changes to roles, which are sent as json to the url.
+type Webhook struct {
+	ID          uuid.UUID
+	URL         string
+	Description string
+	Events      []string
+	CreatedAt   time.Time
+}
+
+// An event sent, or to be sent, to a webhook. Zero times mean not yet, and a zero status means
+// that no response was received.
+type WebhookDelivery struct {
+	ID            int64
+	Event         string
+	Payload       string
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+	DeliveredAt   time.Time
+	LastStatus    int
+	LastError     string
+}
+
+type AuditEntry struct {
+	ID        int64
+	CreatedAt time.Time
+	Actor     string
+	Action    string
+	RoleID    string
+	SystemID  string
+	Target    string
+	Before    string
+	After     string
+}
+
+// Lists the permissions a system should have, see `UI.SyncPermissions`.
+type Manifest struct {
+	Permissions []ManifestPermission `json:"permissions"`
+}
+
+type ManifestPermission struct {
+	ID     string `json:"id"`
+	Scoped bool   `json:"scoped"`
+	// Set as scope on existing instances if the permission didn't have a scope before.
+	DefaultScope string `json:"default_scope,omitempty"`
+}
+
+type PermissionChange struct {
+	PermissionID string `json:"permission"`
+	// One of "create", "delete", "add-scope", "remove-scope" or "obsolete".
+	Change string `json:"change"`
+}
+
+// One way for a user to get a permission: through a mandate, up a chain of superroles, to a role
+// holding an instance of the permission.
+type PermissionGrant struct {
+	Mandate Member `json:"mandate"`
+	// Whether the mandate, the subrole links and the grant of the instance are all current.
+	// Inactive grants explain why a user lacks a permission they may have expected to have.
+	Active bool `json:"active"`
+	// The role of the mandate first, followed by its superroles in order, ending with the role
+	// holding the permission instance.
+	Roles      []string  `json:"roles"`
+	InstanceID uuid.UUID `json:"instance_id"`
+	Scope      string    `json:"scope,omitempty"`
+	// When the role holding the instance has it. Zero means unbounded.
+	GrantStartDate time.Time `json:"grant_start_date"`
+	GrantEndDate   time.Time `json:"grant_end_date"`
+}
+
+// Problems in the data that the database constraints don't prevent, see `UI.CheckConsistency`.
+type ConsistencyReport struct {
+	// Each cycle lists the roles in it, starting with the smallest id, where each role is a
+	// subrole of the next and the last is a subrole of the first.
+	Cycles [][]string
+	// Instances of pls/role or pls/system with a scope naming a role or system that doesn't exist.
+	DanglingScopes []HeldPermissionInstance
+	// Instances not held by any role or api token.
+	OrphanInstances []HeldPermissionInstance
+}
+
+// A mandate to add, as read from an imported file. A zero start date means today.
+type MemberImportRow struct {
+	Line      int       `json:"line"`
+	RoleID    string    `json:"role_id"`
+	KTHID     string    `json:"kth_id"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+type MemberImportResult struct {
+	MemberImportRow
+	// One of "add", "exists" or "error".
+	Change string `json:"change"`
+	// Why the row can't be imported, or something worth noticing about a row that can.
+	Message string `json:"message,omitempty"`
 }
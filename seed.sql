@@ -88,7 +88,9 @@ insert into permission_instances (id, system_id, permission_id, scope) values
     ('00000000-0000-0000-0000-000000000008', 'pls', 'create-role', null),
     ('00000000-0000-0000-0000-000000000009', 'pls', 'system', '*'),
     ('00000000-0000-0000-0000-000000000010', 'pls', 'create-role', null),
-    ('00000000-0000-0000-0000-000000000011', 'pls', 'role', '*');
+    ('00000000-0000-0000-0000-000000000011', 'pls', 'role', '*'),
+    ('00000000-0000-0000-0000-000000000012', 'pls', 'manage-api-tokens', null),
+    ('00000000-0000-0000-0000-000000000013', 'pls', 'manage-webhooks', null);
 
 insert into roles_permissions (permission_instance_id, role_id) values
     ('00000000-0000-0000-0000-000000000000', 'dfunkt'),
@@ -102,6 +104,8 @@ insert into roles_permissions (permission_instance_id, role_id) values
     ('00000000-0000-0000-0000-000000000008', 'drek'),
     ('00000000-0000-0000-0000-000000000009', 'dsys'),
     ('00000000-0000-0000-0000-000000000010', 'dsys'),
-    ('00000000-0000-0000-0000-000000000011', 'dsys');
+    ('00000000-0000-0000-0000-000000000011', 'dsys'),
+    ('00000000-0000-0000-0000-000000000012', 'dsys'),
+    ('00000000-0000-0000-0000-000000000013', 'dsys');
 
 commit;
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/datasektionen/pls4/models"
+)
+
+// Actions that are recorded in the audit log.
+var AuditActions = []string{
+	"create-role", "update-role", "delete-role",
+	"add-member", "update-member", "remove-member",
+	"add-subrole", "update-subrole", "remove-subrole",
+	"add-permission", "update-permission", "remove-permission",
+	"create-system", "delete-system",
+	"create-permission", "delete-permission", "add-scope", "remove-scope",
+	"create-token", "rotate-token", "delete-token",
+	"create-webhook", "delete-webhook",
+}
+
+// Queries selecting a single row as jsonb, for use with `snapshot`.
+const (
+	roleSnapshot = `--sql
+		select to_jsonb(r) from roles r where id = $1
+	`
+	memberSnapshot = `--sql
+		select to_jsonb(ru) from roles_users ru where id = $1
+	`
+	subroleSnapshot = `--sql
+		select to_jsonb(rr) from roles_roles rr where superrole_id = $1 and subrole_id = $2
+	`
+	permissionInstanceSnapshot = `--sql
+		select to_jsonb(i) || jsonb_build_object(
+			'role_id', rp.role_id, 'api_token_id', tp.api_token_id,
+			'start_date', rp.start_date, 'end_date', rp.end_date
+		)
+		from permission_instances i
+		left join roles_permissions rp on rp.permission_instance_id = i.id
+		left join api_tokens_permissions tp on tp.permission_instance_id = i.id
+		where i.id = $1
+	`
+	systemSnapshot = `--sql
+		select to_jsonb(s) from systems s where id = $1
+	`
+	permissionSnapshot = `--sql
+		select to_jsonb(p) from permissions p where system_id = $1 and id = $2
+	`
+	tokenSnapshot = `--sql
+		select to_jsonb(t) - 'secret' from api_tokens t where id = $1
+	`
+	webhookSnapshot = `--sql
+		select to_jsonb(w) - 'secret' from webhooks w where id = $1
+	`
+)
+
+type auditEntry struct {
+	action   string
+	roleID   string
+	systemID string
+	target   string
+	before   []byte
+	after    []byte
+}
+
+// Returns the row selected by `query` as json, or nil if there is no such row.
+func snapshot(tx *sql.Tx, query string, args ...any) ([]byte, error) {
+	var b []byte
+	if err := tx.QueryRow(query, args...).Scan(&b); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Records a change made by `kthID` in the audit log, and queues it for delivery to webhooks
+// subscribed to it if it is a change to a role. Must be called in the same transaction as the
+// change itself, so that the entry is written and sent if and only if the change is.
+func audit(tx *sql.Tx, kthID string, entry auditEntry) error {
+	_, err := tx.Exec(`--sql
+		with entry as (
+			insert into audit_log (actor, action, role_id, system_id, target, before, after)
+			values ($1, $2, nullif($3, ''), nullif($4, ''), $5, $6::jsonb, $7::jsonb)
+			returning *
+		)
+		insert into webhook_deliveries (webhook_id, event, payload)
+		select w.id, e.action, jsonb_build_object(
+			'event', e.action, 'created_at', e.created_at, 'actor', e.actor,
+			'role_id', e.role_id, 'system_id', e.system_id, 'target', e.target,
+			'before', e.before, 'after', e.after
+		)
+		from entry e
+		inner join webhooks w
+			on e.action = any(w.events)
+		where e.role_id is not null
+	`,
+		kthID, entry.action, entry.roleID, entry.systemID, entry.target,
+		jsonOrNull(entry.before), jsonOrNull(entry.after),
+	)
+	return err
+}
+
+func jsonOrNull(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+type AuditFilter struct {
+	RoleID   string
+	SystemID string
+	Actor    string
+	Action   string
+	// Only return entries older than the one with this id. Zero means no limit.
+	BeforeID int64
+	Limit    int
+}
+
+// Returns entries from the audit log matching the filter, newest first.
+func (ui *UI) GetAuditLog(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select
+			id, created_at, actor, action,
+			coalesce(role_id, ''), coalesce(system_id, ''), target,
+			coalesce(before::text, ''), coalesce(after::text, '')
+		from audit_log
+		where ($1 = '' or role_id = $1)
+		and ($2 = '' or system_id = $2)
+		and ($3 = '' or actor = $3)
+		and ($4 = '' or action = $4)
+		and ($5 = 0 or id < $5)
+		order by id desc
+		limit $6
+	`, filter.RoleID, filter.SystemID, filter.Actor, filter.Action, filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(
+			&e.ID, &e.CreatedAt, &e.Actor, &e.Action,
+			&e.RoleID, &e.SystemID, &e.Target,
+			&e.Before, &e.After,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
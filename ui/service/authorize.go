@@ -3,18 +3,53 @@ package service
 import (
 	"context"
 	"slices"
+	"strings"
+
+	"github.com/datasektionen/pls4/api"
+	"github.com/google/uuid"
 )
 
+const tokenActorPrefix = "token:"
+
+// Returns what is used in place of a kth id when an api token acts through the service. It is
+// recorded as such in e.g. `modified_by` and the audit log, and permissions are checked against
+// the permissions of the token.
+func TokenActor(tokenID uuid.UUID) string {
+	return tokenActorPrefix + tokenID.String()
+}
+
+func (ui *UI) getScopes(ctx context.Context, kthID, system, permission string) ([]string, error) {
+	if id, ok := strings.CutPrefix(kthID, tokenActorPrefix); ok {
+		tokenID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		return ui.api.TokenGetScopes(ctx, tokenID, system, permission)
+	}
+	return ui.api.UserGetScopes(ctx, kthID, system, permission)
+}
+
+func (ui *UI) checkPermission(ctx context.Context, kthID, system, permission string) (bool, error) {
+	if id, ok := strings.CutPrefix(kthID, tokenActorPrefix); ok {
+		tokenID, err := uuid.Parse(id)
+		if err != nil {
+			return false, err
+		}
+		return ui.api.TokenCheckPermission(ctx, tokenID, system, permission)
+	}
+	return ui.api.UserCheckPermission(ctx, kthID, system, permission)
+}
+
 func (ui *UI) MayUpdateRole(ctx context.Context, kthID, roleID string) (bool, error) {
-	scopes, err := ui.api.UserGetScopes(ctx, kthID, "pls", "role")
+	scopes, err := ui.getScopes(ctx, kthID, "pls", "role")
 	if err != nil {
 		return false, err
 	}
-	return slices.ContainsFunc(scopes, func(r string) bool { return r == "*" || r == roleID }), nil
+	return api.AnyScopeMatches(scopes, roleID), nil
 }
 
 func (ui *UI) MayCreateRoles(ctx context.Context, kthID string) (bool, error) {
-	return ui.api.UserCheckPermission(ctx, kthID, "pls", "create-role")
+	return ui.checkPermission(ctx, kthID, "pls", "create-role")
 }
 
 func (ui *UI) MayDeleteRole(ctx context.Context, kthID, roleID string) (bool, error) {
@@ -38,28 +73,31 @@ func (ui *UI) MayDeleteRoles(ctx context.Context, kthID string) (map[string]stru
 		return make(map[string]struct{}), nil
 	}
 	deletable := make(map[string]struct{})
-	roles, err := ui.api.UserGetScopes(ctx, kthID, "pls", "role")
+	scopes, err := ui.getScopes(ctx, kthID, "pls", "role")
 	if err != nil {
 		return nil, err
 	}
-	if slices.Contains(roles, "*") {
+	roles := scopes
+	if slices.ContainsFunc(scopes, func(scope string) bool { return strings.Contains(scope, "*") }) {
 		roles, err = ui.GetAllRoles(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 	for _, role := range roles {
-		deletable[role] = struct{}{}
+		if api.AnyScopeMatches(scopes, role) {
+			deletable[role] = struct{}{}
+		}
 	}
 	return deletable, nil
 }
 
 func (ui *UI) MayUpdatePermissionsInSystem(ctx context.Context, kthID, system string) (bool, error) {
-	systems, err := ui.api.UserGetScopes(ctx, kthID, "pls", "system")
+	systems, err := ui.getScopes(ctx, kthID, "pls", "system")
 	if err != nil {
 		return false, err
 	}
-	return slices.ContainsFunc(systems, func(s string) bool { return s == "*" || s == system }), nil
+	return api.AnyScopeMatches(systems, system), nil
 }
 
 func (ui *UI) MayUpdatePermissionsInSystems(ctx context.Context, kthID string, systems ...[]string) (map[string]struct{}, error) {
@@ -91,13 +129,25 @@ func (ui *UI) MayUpdatePermissionsInSystems(ctx context.Context, kthID string, s
 }
 
 func (ui *UI) MayAddPermissions(ctx context.Context, kthID string) (bool, error) {
-	return ui.api.UserCheckPermission(ctx, kthID, "pls", "system")
+	return ui.checkPermission(ctx, kthID, "pls", "system")
 }
 
 func (ui *UI) MayCreateSystems(ctx context.Context, kthID string) (bool, error) {
-	return ui.api.UserCheckPermission(ctx, kthID, "pls", "manage-systems")
+	return ui.checkPermission(ctx, kthID, "pls", "manage-systems")
 }
 
 func (ui *UI) MayDeleteSystems(ctx context.Context, kthID string) (bool, error) {
-	return ui.api.UserCheckPermission(ctx, kthID, "pls", "manage-systems")
+	return ui.checkPermission(ctx, kthID, "pls", "manage-systems")
+}
+
+func (ui *UI) MayCheckConsistency(ctx context.Context, kthID string) (bool, error) {
+	return ui.checkPermission(ctx, kthID, "pls", "manage-systems")
+}
+
+func (ui *UI) MayManageTokens(ctx context.Context, kthID string) (bool, error) {
+	return ui.checkPermission(ctx, kthID, "pls", "manage-api-tokens")
+}
+
+func (ui *UI) MayManageWebhooks(ctx context.Context, kthID string) (bool, error) {
+	return ui.checkPermission(ctx, kthID, "pls", "manage-webhooks")
 }
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/datasektionen/pls4/models"
+)
+
+// Looks for subrole cycles, scopes referring to roles or systems that don't exist and permission
+// instances that nobody holds.
+func (ui *UI) CheckConsistency(ctx context.Context, kthID string) (*models.ConsistencyReport, error) {
+	if ok, err := ui.MayCheckConsistency(ctx, kthID); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, forbidden("You may not check the consistency of pls.")
+	}
+	var report models.ConsistencyReport
+	var err error
+	if report.Cycles, err = ui.findCycles(ctx); err != nil {
+		return nil, err
+	}
+	if report.DanglingScopes, err = ui.findInstances(ctx, `--sql
+		select i.id, i.system_id, i.permission_id, i.scope, coalesce(rp.role_id, '')
+		from permission_instances i
+		left join roles_permissions rp
+			on rp.permission_instance_id = i.id
+		where i.system_id = 'pls'
+		and i.scope not like '%*%'
+		and (
+			i.permission_id = 'role' and not exists (select 1 from roles where id = i.scope)
+			or i.permission_id = 'system' and not exists (select 1 from systems where id = i.scope)
+		)
+		order by i.permission_id, i.scope
+	`); err != nil {
+		return nil, err
+	}
+	if report.OrphanInstances, err = ui.findInstances(ctx, `--sql
+		select i.id, i.system_id, i.permission_id, coalesce(i.scope, ''), ''
+		from permission_instances i
+		where not exists (select 1 from roles_permissions where permission_instance_id = i.id)
+		and not exists (select 1 from api_tokens_permissions where permission_instance_id = i.id)
+		order by i.system_id, i.permission_id, i.scope
+	`); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Returns one cycle for each group of roles that are (transitively) subroles of each other,
+// rotated to start with its smallest role id. Once that cycle is broken, any other cycle in the
+// group is found the next time. The groups are found with Tarjan's algorithm, so this takes time
+// linear in the number of links.
+func (ui *UI) findCycles(ctx context.Context) ([][]string, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select subrole_id, superrole_id
+		from roles_roles
+	`)
+	if err != nil {
+		return nil, err
+	}
+	superroles := make(map[string][]string)
+	for rows.Next() {
+		var subroleID, superroleID string
+		if err := rows.Scan(&subroleID, &superroleID); err != nil {
+			return nil, err
+		}
+		superroles[subroleID] = append(superroles[subroleID], superroleID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var cycles [][]string
+	for _, component := range stronglyConnected(superroles) {
+		if len(component) == 1 && !slices.Contains(superroles[component[0]], component[0]) {
+			continue
+		}
+		cycles = append(cycles, shortestCycle(superroles, component))
+	}
+	slices.SortFunc(cycles, func(a, b []string) int { return slices.Compare(a, b) })
+	return cycles, nil
+}
+
+// Returns the strongly connected components of the graph using Tarjan's algorithm.
+func stronglyConnected(edges map[string][]string) [][]string {
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+
+	var visit func(node string)
+	visit = func(node string) {
+		index[node] = len(index)
+		lowlink[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, next := range edges[node] {
+			if _, ok := index[next]; !ok {
+				visit(next)
+				lowlink[node] = min(lowlink[node], lowlink[next])
+			} else if onStack[next] {
+				lowlink[node] = min(lowlink[node], index[next])
+			}
+		}
+		if lowlink[node] != index[node] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == node {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+
+	// Visit in a fixed order so that the result doesn't depend on map iteration.
+	nodes := make([]string, 0, len(edges))
+	for node := range edges {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+	for _, node := range nodes {
+		if _, ok := index[node]; !ok {
+			visit(node)
+		}
+	}
+	return components
+}
+
+// Returns the shortest cycle through the smallest node of a strongly connected component, found
+// with a breadth-first search that stays within the component.
+func shortestCycle(edges map[string][]string, component []string) []string {
+	start := slices.Min(component)
+	inComponent := make(map[string]bool, len(component))
+	for _, node := range component {
+		inComponent[node] = true
+	}
+	parent := map[string]string{start: ""}
+	queue := []string{start}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[node] {
+			if next == start {
+				var cycle []string
+				for n := node; n != ""; n = parent[n] {
+					cycle = append(cycle, n)
+				}
+				slices.Reverse(cycle)
+				return cycle
+			}
+			if _, seen := parent[next]; seen || !inComponent[next] {
+				continue
+			}
+			parent[next] = node
+			queue = append(queue, next)
+		}
+	}
+	return []string{start}
+}
+
+func (ui *UI) findInstances(ctx context.Context, query string) ([]models.HeldPermissionInstance, error) {
+	rows, err := ui.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var instances []models.HeldPermissionInstance
+	for rows.Next() {
+		var i models.HeldPermissionInstance
+		if err := rows.Scan(&i.ID, &i.SystemID, &i.PermissionID, &i.Scope, &i.RoleID); err != nil {
+			return nil, err
+		}
+		instances = append(instances, i)
+	}
+	return instances, rows.Err()
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type ErrorKind int
+
+const (
+	// The user is not allowed to do what they tried to do.
+	Forbidden ErrorKind = iota + 1
+	// Something that was referred to does not exist.
+	NotFound
+	// The change can not be made given the current state, e.g. because it already exists.
+	Conflict
+	// The input was invalid.
+	Invalid
+)
+
+// An error caused by the request rather than by the service itself. The message is meant to be
+// shown to the user.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func forbidden(message string) error {
+	return &Error{Forbidden, message}
+}
+
+func notFound(message string) error {
+	return &Error{NotFound, message}
+}
+
+func conflict(message string) error {
+	return &Error{Conflict, message}
+}
+
+func invalid(message string) error {
+	return &Error{Invalid, message}
+}
+
+// Translates constraint violations reported by the database to errors of the corresponding kind.
+// Other errors are returned as is.
+func dbError(err error) error {
+	var e *pq.Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	switch e.Code.Name() {
+	case "unique_violation":
+		return conflict(e.Detail)
+	case "foreign_key_violation":
+		if strings.HasPrefix(e.Message, "insert or update") {
+			return notFound(e.Detail)
+		}
+		return conflict(e.Detail)
+	case "check_violation":
+		if strings.HasSuffix(e.Constraint, "id_check") {
+			return invalid("Ids may only contain lowercase letters, digits and single dashes.")
+		}
+		return invalid("Invalid value for " + e.Table + ".")
+	}
+	return err
+}
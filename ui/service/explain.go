@@ -0,0 +1,20 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/datasektionen/pls4/models"
+)
+
+// Returns every way in which the user gets the permission, see `api.UserExplainPermission`.
+func (ui *UI) ExplainPermission(ctx context.Context, kthID, system, permission string) ([]models.PermissionGrant, error) {
+	permissions, err := ui.GetPermissions(ctx, system)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(permissions, func(p models.Permission) bool { return p.ID == permission }) {
+		return nil, notFound("No permission " + permission + " in system " + system + ".")
+	}
+	return ui.api.UserExplainPermission(ctx, kthID, system, permission)
+}
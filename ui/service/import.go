@@ -0,0 +1,184 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datasektionen/pls4/models"
+)
+
+// Reads mandates from comma or tab separated values with the columns role_id, kth_id, start_date
+// and end_date. The separator is whichever of the two appears first in the input. A first line
+// starting with `role_id` is taken to be a header and skipped.
+func ParseMemberImport(r io.Reader) ([]models.MemberImportRow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	if i := bytes.IndexAny(data, ",\t"); i != -1 && data[i] == '\t' {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+	var rows []models.MemberImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, invalid("Line " + strconv.Itoa(parseErr.Line) + ": " + parseErr.Err.Error() + ".")
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(rows) == 0 && line == 1 && strings.TrimSpace(record[0]) == "role_id" {
+			continue
+		}
+		row := models.MemberImportRow{
+			Line:   line,
+			RoleID: strings.TrimSpace(record[0]),
+			KTHID:  strings.TrimSpace(record[1]),
+		}
+		if s := strings.TrimSpace(record[2]); s != "" {
+			if row.StartDate, err = time.Parse(time.DateOnly, s); err != nil {
+				return nil, invalid("Line " + strconv.Itoa(line) + ": invalid start date " + s + ", expected YYYY-MM-DD.")
+			}
+		}
+		if s := strings.TrimSpace(record[3]); s != "" {
+			if row.EndDate, err = time.Parse(time.DateOnly, s); err != nil {
+				return nil, invalid("Line " + strconv.Itoa(line) + ": invalid end date " + s + ", expected YYYY-MM-DD.")
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, invalid("There are no mandates to import.")
+	}
+	return rows, nil
+}
+
+// Checks every row and, unless `dryRun` is set, adds all mandates that don't already exist in one
+// transaction with `kthID` as `modified_by`. If any row has an error nothing is added, and an
+// error is returned together with the results so that the problems can be shown.
+func (ui *UI) ImportMembers(
+	ctx context.Context,
+	kthID string,
+	rows []models.MemberImportRow,
+	dryRun bool,
+) ([]models.MemberImportResult, error) {
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	today := time.Now().Truncate(24 * time.Hour)
+	mayUpdate := make(map[string]bool)
+	seen := make(map[models.MemberImportRow]int)
+	results := make([]models.MemberImportResult, len(rows))
+	failed := 0
+	for i, row := range rows {
+		if row.StartDate.IsZero() {
+			row.StartDate = today
+		}
+		result := &results[i]
+		result.MemberImportRow = row
+		result.Change, result.Message, err = ui.checkImportRow(ctx, tx, kthID, row, mayUpdate)
+		if err != nil {
+			return nil, err
+		}
+		key := row
+		key.Line = 0
+		if line, ok := seen[key]; ok && result.Change != "error" {
+			result.Change = "error"
+			result.Message = "Same as line " + strconv.Itoa(line) + "."
+		}
+		seen[key] = row.Line
+		if result.Change == "error" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, invalid(strconv.Itoa(failed) + " of the rows can not be imported.")
+	}
+	if dryRun {
+		return results, nil
+	}
+
+	for _, result := range results {
+		if result.Change != "add" {
+			continue
+		}
+		if _, err := addMember(tx, kthID, result.RoleID, result.KTHID, result.StartDate, result.EndDate); err != nil {
+			return nil, err
+		}
+	}
+	return results, tx.Commit()
+}
+
+// Returns the change a row would make and a message explaining it. `mayUpdate` caches which roles
+// `kthID` may update.
+func (ui *UI) checkImportRow(
+	ctx context.Context,
+	tx *sql.Tx,
+	kthID string,
+	row models.MemberImportRow,
+	mayUpdate map[string]bool,
+) (string, string, error) {
+	if row.KTHID == "" {
+		return "error", "A kth id is required.", nil
+	}
+	if row.EndDate.IsZero() {
+		return "error", "An end date is required.", nil
+	}
+	if row.EndDate.Before(row.StartDate) {
+		return "error", "The end date must not be before the start date.", nil
+	}
+	var exists bool
+	if err := tx.QueryRow(`--sql
+		select exists (select 1 from roles where id = $1)
+	`, row.RoleID).Scan(&exists); err != nil {
+		return "", "", err
+	}
+	if !exists {
+		return "error", "No role with id " + row.RoleID + ".", nil
+	}
+	may, ok := mayUpdate[row.RoleID]
+	if !ok {
+		var err error
+		if may, err = ui.MayUpdateRole(ctx, kthID, row.RoleID); err != nil {
+			return "", "", err
+		}
+		mayUpdate[row.RoleID] = may
+	}
+	if !may {
+		return "error", "You may not update the role " + row.RoleID + ".", nil
+	}
+	var same, overlapping int
+	if err := tx.QueryRow(`--sql
+		select
+			count(*) filter (where start_date = $3::date and end_date = $4::date),
+			count(*) filter (where start_date <= $4::date and end_date >= $3::date)
+		from roles_users
+		where role_id = $1 and kth_id = $2
+	`, row.RoleID, row.KTHID, row.StartDate, row.EndDate).Scan(&same, &overlapping); err != nil {
+		return "", "", err
+	}
+	if same > 0 {
+		return "exists", "", nil
+	}
+	if overlapping > 0 {
+		return "add", "Overlaps an existing mandate in the same role.", nil
+	}
+	return "add", "", nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/datasektionen/pls4/models"
+)
+
+// Makes the permissions in the system match the manifest. Permissions missing from the system are
+// created and scopes are added or removed where they differ. Permissions not in the manifest are
+// deleted if `prune` is set and otherwise only reported as obsolete. If `dryRun` is set nothing is
+// changed. Either way the changes that were, or would have been, made are returned.
+func (ui *UI) SyncPermissions(
+	ctx context.Context,
+	kthID, system string,
+	manifest models.Manifest,
+	prune, dryRun bool,
+) ([]models.PermissionChange, error) {
+	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, forbidden("You may not update permissions in the system " + system + ".")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`--sql
+		select exists (select 1 from systems where id = $1)
+	`, system).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, notFound("No system with id " + system + ".")
+	}
+	rows, err := tx.Query(`--sql
+		select id, has_scope
+		from permissions
+		where system_id = $1
+		order by id
+		for update
+	`, system)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool)
+	var currentIDs []string
+	for rows.Next() {
+		var id string
+		var hasScope bool
+		if err := rows.Scan(&id, &hasScope); err != nil {
+			return nil, err
+		}
+		current[id] = hasScope
+		currentIDs = append(currentIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	changes := []models.PermissionChange{}
+	seen := make(map[string]struct{})
+	for _, perm := range manifest.Permissions {
+		if _, ok := seen[perm.ID]; ok {
+			return nil, invalid("The permission " + perm.ID + " is listed more than once.")
+		}
+		seen[perm.ID] = struct{}{}
+
+		hasScope, ok := current[perm.ID]
+		var change string
+		var err error
+		switch {
+		case !ok:
+			change = "create"
+			err = createPermission(tx, kthID, system, perm.ID, perm.Scoped)
+		case perm.Scoped && !hasScope:
+			if perm.DefaultScope == "" {
+				return nil, invalid("A default scope is required to add a scope to " + perm.ID + ".")
+			}
+			change = "add-scope"
+			err = addScopeToPermission(tx, kthID, system, perm.ID, perm.DefaultScope)
+		case !perm.Scoped && hasScope:
+			change = "remove-scope"
+			err = removeScopeFromPermission(tx, kthID, system, perm.ID)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, models.PermissionChange{PermissionID: perm.ID, Change: change})
+	}
+	for _, id := range currentIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		if !prune {
+			changes = append(changes, models.PermissionChange{PermissionID: id, Change: "obsolete"})
+			continue
+		}
+		if err := deletePermission(tx, kthID, system, id); err != nil {
+			return nil, err
+		}
+		changes = append(changes, models.PermissionChange{PermissionID: id, Change: "delete"})
+	}
+	slices.SortStableFunc(changes, func(a, b models.PermissionChange) int {
+		return strings.Compare(a.PermissionID, b.PermissionID)
+	})
+
+	if dryRun {
+		// The changes were made to be able to report errors they would cause, but they are rolled
+		// back.
+		return changes, nil
+	}
+	return changes, tx.Commit()
+}
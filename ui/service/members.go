@@ -2,43 +2,85 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"slices"
 	"time"
 
 	"github.com/datasektionen/pls4/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-func (ui *UI) GetRoleMembers(ctx context.Context, id string, includeExpired bool, includeIndirect bool) ([]models.Member, error) {
+// Which mandates to include when listing members.
+type MemberPeriod string
+
+const (
+	CurrentMembers  MemberPeriod = "current"
+	UpcomingMembers MemberPeriod = "upcoming"
+	ExpiredMembers  MemberPeriod = "expired"
+	AllMembers      MemberPeriod = "all"
+)
+
+var MemberPeriods = []MemberPeriod{CurrentMembers, UpcomingMembers, ExpiredMembers, AllMembers}
+
+// Parses a member period, where the empty string means current members.
+func ParseMemberPeriod(s string) (MemberPeriod, error) {
+	if s == "" {
+		return CurrentMembers, nil
+	}
+	if !slices.Contains(MemberPeriods, MemberPeriod(s)) {
+		return "", invalid("Invalid period " + s + ". Must be one of current, upcoming, expired or all.")
+	}
+	return MemberPeriod(s), nil
+}
+
+// Returns a condition for whether the mandate in the current row lies in the period given by the
+// query parameter `param`.
+func periodCondition(param string) string {
+	return `/*sql*/ case ` + param + `::text
+		when 'current' then now() between start_date and end_date
+		when 'upcoming' then start_date > now()
+		when 'expired' then end_date < now()
+		else true
+	end`
+}
+
+// Returns the members of the role with mandates in the period. With `includeIndirect`, members of
+// sub-roles are included as well, with one row per person and `Via` set to the direct sub-roles
+// they are members through.
+func (ui *UI) GetRoleMembers(ctx context.Context, id string, period MemberPeriod, includeIndirect bool) ([]models.Member, error) {
 	query := `--sql
 		select
 			id, kth_id, modified_by,
-			modified_at, start_date, end_date
+			modified_at, start_date, end_date,
+			'{}'::text[] as via
 		from roles_users
 		where role_id = $1
-		and ($2 or now() between start_date and end_date)
+		and ` + periodCondition("$2") + `
 		order by kth_id
 	`
 	if includeIndirect {
-		query = `/*sql*/ with recursive all_subroles (role_id) as (
-				select subrole_id
-				from roles_roles
+		query = `/*sql*/ with recursive all_subroles (role_id, via) as (
+				select subrole_id, subrole_id
+				from current_roles_roles
 				where superrole_id = $1
 				union
-				select subrole_id from all_subroles
-				inner join roles_roles
+				select subrole_id, via from all_subroles
+				inner join current_roles_roles
 				on superrole_id = role_id
 		) (` + query + `/*sql*/) union all
 		(select
 			null as id, kth_id, '' as modified_by,
-			max(modified_at), min(start_date), max(end_date)
+			max(modified_at), min(start_date), max(end_date),
+			array_agg(distinct via order by via)
 		from all_subroles
 		inner join roles_users using (role_id)
-		where ($2 or now() between start_date and end_date)
+		where ` + periodCondition("$2") + `
 		group by kth_id
 		order by kth_id)`
 	}
 
-	rows, err := ui.db.QueryContext(ctx, query, id, includeExpired)
+	rows, err := ui.db.QueryContext(ctx, query, id, period)
 	if err != nil {
 		return nil, err
 	}
@@ -48,6 +90,7 @@ func (ui *UI) GetRoleMembers(ctx context.Context, id string, includeExpired bool
 		if err := rows.Scan(
 			&m.MemberID, &m.KTHID, &m.ModifiedBy,
 			&m.ModifiedAt, &m.StartDate, &m.EndDate,
+			pq.Array(&m.Via),
 		); err != nil {
 			return nil, err
 		}
@@ -56,6 +99,59 @@ func (ui *UI) GetRoleMembers(ctx context.Context, id string, includeExpired bool
 	return members, nil
 }
 
+// Returns the mandates of the user in the period, with the latest first. Uses the same check for
+// whether a mandate is current as permission resolution does.
+func (ui *UI) GetUserMandates(ctx context.Context, kthID string, period MemberPeriod) ([]models.Mandate, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select
+			m.id, m.kth_id, m.modified_by, m.modified_at, m.start_date, m.end_date,
+			r.id, r.display_name
+		from roles_users m
+		inner join roles r
+			on r.id = m.role_id
+		where m.kth_id = $1
+		and `+periodCondition("$2")+`
+		order by m.end_date desc, m.start_date desc, r.display_name
+	`, kthID, period)
+	if err != nil {
+		return nil, err
+	}
+	return scanMandates(rows)
+}
+
+// Returns the mandates in the period of everyone in every role, ordered by role and date.
+func (ui *UI) GetAllMandates(ctx context.Context, period MemberPeriod) ([]models.Mandate, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select
+			m.id, m.kth_id, m.modified_by, m.modified_at, m.start_date, m.end_date,
+			r.id, r.display_name
+		from roles_users m
+		inner join roles r
+			on r.id = m.role_id
+		where `+periodCondition("$1")+`
+		order by r.id, m.start_date, m.kth_id
+	`, period)
+	if err != nil {
+		return nil, err
+	}
+	return scanMandates(rows)
+}
+
+func scanMandates(rows *sql.Rows) ([]models.Mandate, error) {
+	var mandates []models.Mandate
+	for rows.Next() {
+		var m models.Mandate
+		if err := rows.Scan(
+			&m.MemberID, &m.KTHID, &m.ModifiedBy, &m.ModifiedAt, &m.StartDate, &m.EndDate,
+			&m.RoleID, &m.RoleDisplayName,
+		); err != nil {
+			return nil, err
+		}
+		mandates = append(mandates, m)
+	}
+	return mandates, rows.Err()
+}
+
 func (ui *UI) UpdateMember(
 	ctx context.Context,
 	kthID, roleID string,
@@ -66,16 +162,35 @@ func (ui *UI) UpdateMember(
 	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not update the role " + roleID + ".")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := updateMember(tx, kthID, roleID, memberID, startDate, endDate); err != nil {
+		return err
 	}
-	res, err := ui.db.ExecContext(ctx, `--sql
+	return tx.Commit()
+}
+
+// Sets the dates of a mandate in the transaction and records the change in the audit log. Zero
+// dates are left unchanged.
+func updateMember(tx *sql.Tx, kthID, roleID string, memberID uuid.UUID, startDate, endDate time.Time) error {
+	before, err := snapshot(tx, memberSnapshot, memberID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`--sql
 		update roles_users
 		set
 			start_date = case when $3 then $4 else start_date end,
-			end_date = case when $5 then $6 else end_date end
+			end_date = case when $5 then $6 else end_date end,
+			modified_by = $7,
+			modified_at = now()
 		where id = $1 and role_id = $2
-	`, memberID, roleID, startDate != time.Time{}, startDate, endDate != time.Time{}, endDate)
+	`, memberID, roleID, startDate != time.Time{}, startDate, endDate != time.Time{}, endDate, kthID)
 	if err != nil {
 		return err
 	}
@@ -84,9 +199,16 @@ func (ui *UI) UpdateMember(
 		return err
 	}
 	if n != 1 {
-		// TODO: invalid id
+		return notFound("No member with id " + memberID.String() + " in the role " + roleID + ".")
+	}
+	after, err := snapshot(tx, memberSnapshot, memberID)
+	if err != nil {
+		return err
 	}
-	return nil
+	return audit(tx, kthID, auditEntry{
+		action: "update-member", roleID: roleID, target: memberID.String(),
+		before: before, after: after,
+	})
 }
 
 func (ui *UI) AddMember(
@@ -94,28 +216,53 @@ func (ui *UI) AddMember(
 	kthID, roleID, memberKTHID string,
 	startDate time.Time,
 	endDate time.Time,
-) error {
+) (uuid.UUID, error) {
 	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
-		return err
+		return uuid.Nil, err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return uuid.Nil, forbidden("You may not update the role " + roleID + ".")
+	}
+	if endDate == (time.Time{}) {
+		return uuid.Nil, invalid("An end date is required.")
+	}
+	if startDate == (time.Time{}) {
+		startDate = time.Now().Truncate(24 * time.Hour)
+	}
+	if endDate.Before(startDate) {
+		return uuid.Nil, invalid("The end date must not be before the start date.")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	memberID, err := addMember(tx, kthID, roleID, memberKTHID, startDate, endDate)
+	if err != nil {
+		return uuid.Nil, err
 	}
-	res, err := ui.db.ExecContext(ctx, `--sql
+	return memberID, tx.Commit()
+}
+
+// Adds a mandate in the transaction and records it in the audit log.
+func addMember(tx *sql.Tx, kthID, roleID, memberKTHID string, startDate, endDate time.Time) (uuid.UUID, error) {
+	var memberID uuid.UUID
+	if err := tx.QueryRow(`--sql
 		insert into roles_users (role_id, kth_id, modified_by, start_date, end_date)
 		values ($1, $2, $3, $4, $5)
-	`, roleID, memberKTHID, kthID, startDate, endDate)
-	if err != nil {
-		return err
+		returning id
+	`, roleID, memberKTHID, kthID, startDate, endDate).Scan(&memberID); err != nil {
+		return uuid.Nil, dbError(err)
 	}
-	n, err := res.RowsAffected()
+	after, err := snapshot(tx, memberSnapshot, memberID)
 	if err != nil {
-		return err
+		return uuid.Nil, err
 	}
-	if n != 1 {
-		// TODO: invalid id
+	if err := audit(tx, kthID, auditEntry{
+		action: "add-member", roleID: roleID, target: memberID.String(), after: after,
+	}); err != nil {
+		return uuid.Nil, err
 	}
-	return nil
+	return memberID, nil
 }
 
 func (ui *UI) RemoveMember(
@@ -126,10 +273,18 @@ func (ui *UI) RemoveMember(
 	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not update the role " + roleID + ".")
 	}
-	res, err := ui.db.ExecContext(ctx, `--sql
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := snapshot(tx, memberSnapshot, memberID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`--sql
 		delete from roles_users
 		where role_id = $1 and id = $2
 	`, roleID, memberID)
@@ -141,8 +296,12 @@ func (ui *UI) RemoveMember(
 		return err
 	}
 	if n != 1 {
-		// TODO: invalid id
+		return notFound("No member with id " + memberID.String() + " in the role " + roleID + ".")
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "remove-member", roleID: roleID, target: memberID.String(), before: before,
+	}); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
-
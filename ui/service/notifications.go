@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/datasektionen/pls4/api"
+	"github.com/datasektionen/pls4/models"
+)
+
+// Sent when a mandate is about to end, to the member and to everyone who may update the role.
+type ExpiryNotification struct {
+	Mandate models.Mandate `json:"mandate"`
+	// The kth ids of those who may update the role, not including the member.
+	Managers []string `json:"managers"`
+}
+
+// Delivers expiry notifications, e.g. by email.
+type Notifier interface {
+	Notify(ctx context.Context, notification ExpiryNotification) error
+}
+
+func (ui *UI) notifyExpiringMandatesForever(ctx context.Context) {
+	if ui.notifier == nil {
+		return
+	}
+loop:
+	for {
+		if err := ui.notifyExpiringMandates(ctx); err != nil {
+			slog.Error("Could not notify about expiring mandates", "error", err)
+		}
+		select {
+		case <-time.After(time.Hour):
+			continue
+		case <-ctx.Done():
+			break loop
+		}
+	}
+}
+
+// Notifies about every current mandate that ends within `expiryNoticeDays` and has not already
+// been notified about. A notification is recorded as sent before it is sent, so one that is
+// interrupted by a crash is lost rather than sent twice. Mandates in roles that have opted out are skipped, as are mandates that
+// are continued by another mandate for the same person in the same role, e.g. after a renewal.
+func (ui *UI) notifyExpiringMandates(ctx context.Context) error {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select
+			m.id, m.kth_id, m.modified_by, m.modified_at, m.start_date, m.end_date,
+			r.id, r.display_name
+		from roles_users m
+		inner join roles r
+			on r.id = m.role_id
+		where r.notify_expiry
+		and now() between m.start_date and m.end_date
+		and m.end_date < now() + make_interval(days => $1)
+		and not exists (
+			select 1 from expiry_notifications n
+			where n.member_id = m.id and n.end_date = m.end_date
+		)
+		and not exists (
+			select 1 from roles_users c
+			where c.role_id = m.role_id and c.kth_id = m.kth_id
+			and c.start_date <= m.end_date + 1 and c.end_date > m.end_date
+		)
+		order by m.end_date, r.id, m.kth_id
+	`, ui.expiryNoticeDays)
+	if err != nil {
+		return err
+	}
+	mandates, err := scanMandates(rows)
+	if err != nil || len(mandates) == 0 {
+		return err
+	}
+
+	managers, err := ui.getRoleManagers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, mandate := range mandates {
+		notification := ExpiryNotification{Mandate: mandate, Managers: []string{}}
+		for kthID, scopes := range managers {
+			if kthID != mandate.KTHID && api.AnyScopeMatches(scopes, mandate.RoleID) {
+				notification.Managers = append(notification.Managers, kthID)
+			}
+		}
+		// Claim the notification before sending it, so that when several instances run this at
+		// once, only one of them sends it.
+		res, err := ui.db.ExecContext(ctx, `--sql
+			insert into expiry_notifications (member_id, end_date)
+			values ($1, $2)
+			on conflict do nothing
+		`, mandate.MemberID, mandate.EndDate)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			continue
+		}
+		if err := ui.notifier.Notify(ctx, notification); err != nil {
+			slog.Error("Could not send expiry notification", "error", err, "member_id", mandate.MemberID)
+			// Release the claim so that the notification is tried again next time.
+			if _, err := ui.db.ExecContext(ctx, `--sql
+				delete from expiry_notifications
+				where member_id = $1 and end_date = $2
+			`, mandate.MemberID, mandate.EndDate); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the scopes of the permission pls/role for everyone who currently has it.
+func (ui *UI) getRoleManagers(ctx context.Context) (map[string][]string, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		with recursive holders (kth_id, role_id) as (
+			select kth_id, role_id from roles_users
+			where now() between start_date and end_date
+			union
+			select kth_id, superrole_id from holders
+			inner join current_roles_roles
+				on subrole_id = role_id
+		)
+		select distinct kth_id, coalesce(scope, '') from holders
+		inner join current_roles_permissions p
+			using (role_id)
+		inner join permission_instances i
+			on i.id = p.permission_instance_id
+		where i.system_id = 'pls' and i.permission_id = 'role'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	managers := make(map[string][]string)
+	for rows.Next() {
+		var kthID, scope string
+		if err := rows.Scan(&kthID, &scope); err != nil {
+			return nil, err
+		}
+		managers[kthID] = append(managers[kthID], scope)
+	}
+	return managers, rows.Err()
+}
+
+// Returns whether members of the role are notified when their mandates are about to end.
+func (ui *UI) GetExpiryNotifications(ctx context.Context, roleID string) (bool, error) {
+	var enabled bool
+	if err := ui.db.QueryRowContext(ctx, `--sql
+		select notify_expiry from roles where id = $1
+	`, roleID).Scan(&enabled); err == sql.ErrNoRows {
+		return false, notFound("No role with id " + roleID + ".")
+	} else if err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+func (ui *UI) SetExpiryNotifications(ctx context.Context, kthID, roleID string, enabled bool) error {
+	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
+		return err
+	} else if !ok {
+		return forbidden("You may not update the role " + roleID + ".")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := snapshot(tx, roleSnapshot, roleID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`--sql
+		update roles
+		set notify_expiry = $2
+		where id = $1
+	`, roleID, enabled)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return notFound("No role with id " + roleID + ".")
+	}
+	after, err := snapshot(tx, roleSnapshot, roleID)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "update-role", roleID: roleID, target: roleID,
+		before: before, after: after,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
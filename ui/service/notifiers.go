@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Writes notifications to the log instead of sending them anywhere, for local testing.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n ExpiryNotification) error {
+	slog.InfoContext(ctx, "Mandate is about to end",
+		"kth_id", n.Mandate.KTHID,
+		"role_id", n.Mandate.RoleID,
+		"end_date", n.Mandate.EndDate.Format(time.DateOnly),
+		"managers", n.Managers,
+	)
+	return nil
+}
+
+// Sends notifications by email to the member, with those who may update the role as cc. Addresses
+// are formed by appending `@` and `EmailDomain` to kth ids.
+type SMTPNotifier struct {
+	// Host and port of the smtp server.
+	Address string
+	From    string
+	// If empty, no authentication is done.
+	Username    string
+	Password    string
+	EmailDomain string
+}
+
+func (s SMTPNotifier) Notify(ctx context.Context, n ExpiryNotification) error {
+	to := s.email(n.Mandate.KTHID)
+	cc := make([]string, len(n.Managers))
+	for i, kthID := range n.Managers {
+		cc[i] = s.email(kthID)
+	}
+	endDate := n.Mandate.EndDate.Format(time.DateOnly)
+	subject := "Your mandate as " + n.Mandate.RoleDisplayName + " ends on " + endDate
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", headerValue(s.From))
+	fmt.Fprintf(&msg, "To: %s\r\n", headerValue(to))
+	if len(cc) > 0 {
+		fmt.Fprintf(&msg, "Cc: %s\r\n", headerValue(strings.Join(cc, ", ")))
+	}
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", uuid.New(), headerValue(s.EmailDomain))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Hi %s,\r\n\r\n", n.Mandate.KTHID)
+	fmt.Fprintf(&msg, "Your mandate as %s (%s) ends on %s. ", n.Mandate.RoleDisplayName, n.Mandate.RoleID, endDate)
+	fmt.Fprintf(&msg, "From the start of that day, you no longer have the permissions that come with the role.\r\n\r\n")
+	fmt.Fprintf(&msg, "If the mandate should be extended, ask someone who manages the role to update it. ")
+	fmt.Fprintf(&msg, "They have received a copy of this email.\r\n")
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Address, ":")
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Address, auth, s.From, append([]string{to}, cc...), []byte(msg.String()))
+}
+
+func (s SMTPNotifier) email(kthID string) string {
+	return kthID + "@" + s.EmailDomain
+}
+
+// Removes line breaks, so that a value can not end its header and start another.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// Sends notifications as json in POST requests to a url.
+type WebhookNotifier struct {
+	URL string
+}
+
+func (wh WebhookNotifier) Notify(ctx context.Context, n ExpiryNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", res.Status)
+	}
+	return nil
+}
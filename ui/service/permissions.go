@@ -3,8 +3,8 @@ package service
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/datasektionen/pls4/models"
 	"github.com/google/uuid"
@@ -12,7 +12,7 @@ import (
 
 func (ui *UI) GetRolePermissions(ctx context.Context, id string) ([]models.SystemPermissionInstances, error) {
 	rows, err := ui.db.QueryContext(ctx, `--sql
-		select id, system_id, permission_id, coalesce(scope, '')
+		select id, system_id, permission_id, coalesce(scope, ''), start_date, end_date
 		from roles_permissions
 		inner join permission_instances
 			on id = permission_instance_id
@@ -22,12 +22,34 @@ func (ui *UI) GetRolePermissions(ctx context.Context, id string) ([]models.Syste
 	if err != nil {
 		return nil, err
 	}
+	return scanPermissionInstances(rows)
+}
+
+func (ui *UI) GetTokenPermissions(ctx context.Context, tokenID uuid.UUID) ([]models.SystemPermissionInstances, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select id, system_id, permission_id, coalesce(scope, ''), null::date, null::date
+		from api_tokens_permissions
+		inner join permission_instances
+			on id = permission_instance_id
+		where api_token_id = $1
+		order by system_id, permission_id
+	`, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPermissionInstances(rows)
+}
+
+// Groups rows of (id, system_id, permission_id, scope, start_date, end_date), ordered by system_id,
+// into systems.
+func scanPermissionInstances(rows *sql.Rows) ([]models.SystemPermissionInstances, error) {
 	perms := make([]models.SystemPermissionInstances, 1)
 	p := &perms[0]
 	for rows.Next() {
 		var id uuid.UUID
 		var system, permission, scope string
-		if err := rows.Scan(&id, &system, &permission, &scope); err != nil {
+		var startDate, endDate sql.NullTime
+		if err := rows.Scan(&id, &system, &permission, &scope, &startDate, &endDate); err != nil {
 			return nil, err
 		}
 		if p.System != system {
@@ -41,6 +63,8 @@ func (ui *UI) GetRolePermissions(ctx context.Context, id string) ([]models.Syste
 			ID:           id,
 			PermissionID: permission,
 			Scope:        scope,
+			StartDate:    startDate.Time,
+			EndDate:      endDate.Time,
 		})
 	}
 	return perms[1:], nil
@@ -56,27 +80,55 @@ func (ui *UI) RemovePermission(
 	if err != nil {
 		return err
 	}
-	var system string
+	if err := ui.removePermission(ctx, tx, kthID, permissionInstanceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ui *UI) removePermission(ctx context.Context, tx *sql.Tx, kthID string, permissionInstanceID uuid.UUID) error {
+	var system, roleID string
 	if row := tx.QueryRow(`--sql
-		select system_id
+		select system_id, coalesce(role_id, '')
 		from permission_instances
+		left join roles_permissions
+			on permission_instance_id = id
 		where id = $1
 	`, permissionInstanceID); row.Err() != nil {
 		return row.Err()
-	} else if err := row.Scan(&system); err != nil {
+	} else if err := row.Scan(&system, &roleID); err == sql.ErrNoRows {
+		return notFound("No permission instance with id " + permissionInstanceID.String() + ".")
+	} else if err != nil {
 		return err
 	}
 	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not update permissions in the system " + system + ".")
+	}
+	var heldByToken bool
+	if err := tx.QueryRow(`--sql
+		select exists (
+			select 1 from api_tokens_permissions
+			where permission_instance_id = $1
+		)
+	`, permissionInstanceID).Scan(&heldByToken); err != nil {
+		return err
+	}
+	if heldByToken {
+		if ok, err := ui.MayManageTokens(ctx, kthID); err != nil {
+			return err
+		} else if !ok {
+			return errMayNotManageTokens
+		}
 	}
 
 	slog.InfoContext(ctx, "Removing permission", "id", permissionInstanceID, "system", system)
 
-	// TODO: this must cascade to delete from either roles_permissions or
-	// api_tokens_permissions
+	before, err := snapshot(tx, permissionInstanceSnapshot, permissionInstanceID)
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec(`--sql
 		delete from permission_instances
 		where id = $1
@@ -84,6 +136,42 @@ func (ui *UI) RemovePermission(
 	if err != nil {
 		return err
 	}
+	return audit(tx, kthID, auditEntry{
+		action: "remove-permission", roleID: roleID, systemID: system,
+		target: permissionInstanceID.String(), before: before,
+	})
+}
+
+// Removes a permission instance from a token, failing if the instance is not held by the token.
+func (ui *UI) RemoveTokenPermission(
+	ctx context.Context,
+	kthID string,
+	tokenID uuid.UUID,
+	permissionInstanceID uuid.UUID,
+) error {
+	if ok, err := ui.MayManageTokens(ctx, kthID); err != nil {
+		return err
+	} else if !ok {
+		return errMayNotManageTokens
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var held int
+	if err := tx.QueryRow(`--sql
+		select 1 from api_tokens_permissions
+		where api_token_id = $1 and permission_instance_id = $2
+		for update
+	`, tokenID, permissionInstanceID).Scan(&held); err == sql.ErrNoRows {
+		return notFound("The api token " + tokenID.String() + " has no permission instance with id " + permissionInstanceID.String() + ".")
+	} else if err != nil {
+		return err
+	}
+	if err := ui.removePermission(ctx, tx, kthID, permissionInstanceID); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -95,8 +183,7 @@ func (ui *UI) AddPermissionToRole(
 	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not update permissions in the system " + system + ".")
 	}
 
 	tx, err := ui.db.BeginTx(ctx, nil)
@@ -114,9 +201,127 @@ func (ui *UI) AddPermissionToRole(
 		insert into roles_permissions (permission_instance_id, role_id)
 		values ($1, $2)
 	`, id, roleID)
+	if err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, permissionInstanceSnapshot, id)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "add-permission", roleID: roleID, systemID: system,
+		target: id.String(), after: after,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Sets when the role has the permission instance. Zero dates make the grant unbounded in that
+// direction.
+func (ui *UI) UpdatePermissionDates(
+	ctx context.Context,
+	kthID, roleID string,
+	permissionInstanceID uuid.UUID,
+	startDate, endDate time.Time,
+) error {
+	if !startDate.IsZero() && !endDate.IsZero() && endDate.Before(startDate) {
+		return invalid("The end date may not be before the start date.")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var system string
+	if err := tx.QueryRow(`--sql
+		select system_id
+		from permission_instances
+		inner join roles_permissions
+			on permission_instance_id = id
+		where id = $1 and role_id = $2
+	`, permissionInstanceID, roleID).Scan(&system); err == sql.ErrNoRows {
+		return notFound("The role " + roleID + " has no permission instance with id " + permissionInstanceID.String() + ".")
+	} else if err != nil {
+		return err
+	}
+	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
+		return err
+	} else if !ok {
+		return forbidden("You may not update permissions in the system " + system + ".")
+	}
+	before, err := snapshot(tx, permissionInstanceSnapshot, permissionInstanceID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`--sql
+		update roles_permissions
+		set start_date = $2, end_date = $3
+		where permission_instance_id = $1
+	`,
+		permissionInstanceID,
+		sql.NullTime{Time: startDate, Valid: !startDate.IsZero()},
+		sql.NullTime{Time: endDate, Valid: !endDate.IsZero()},
+	); err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, permissionInstanceSnapshot, permissionInstanceID)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "update-permission", roleID: roleID, systemID: system,
+		target: permissionInstanceID.String(), before: before, after: after,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ui *UI) AddPermissionToToken(
+	ctx context.Context,
+	kthID string,
+	tokenID uuid.UUID,
+	system, permission, scope string,
+) error {
+	if ok, err := ui.MayManageTokens(ctx, kthID); err != nil {
+		return err
+	} else if !ok {
+		return errMayNotManageTokens
+	}
+	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
+		return err
+	} else if !ok {
+		return forbidden("You may not update permissions in the system " + system + ".")
+	}
+
+	tx, err := ui.db.BeginTx(ctx, nil)
+	defer tx.Rollback()
+	if err != nil {
+		return err
+	}
+
+	id, err := createPermissionInstance(tx, system, permission, scope)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`--sql
+		insert into api_tokens_permissions (permission_instance_id, api_token_id)
+		values ($1, $2)
+	`, id, tokenID)
+	if err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, permissionInstanceSnapshot, id)
 	if err != nil {
 		return err
 	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "add-permission", systemID: system, target: id.String(), after: after,
+	}); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -129,11 +334,16 @@ func createPermissionInstance(
 		select has_scope from permissions
 		where system_id = $1
 		and id = $2
-	`, system, permission).Scan(&hasScope); err != nil {
+	`, system, permission).Scan(&hasScope); err == sql.ErrNoRows {
+		return uuid.Nil, notFound("No permission " + permission + " in the system " + system + ".")
+	} else if err != nil {
 		return uuid.Nil, err
 	}
 	if hasScope != (scope != "") {
-		return uuid.Nil, errors.New("Provided scope when there should be one or the other way around")
+		if hasScope {
+			return uuid.Nil, invalid("The permission " + permission + " requires a scope.")
+		}
+		return uuid.Nil, invalid("The permission " + permission + " does not have a scope.")
 	}
 	var id uuid.UUID
 	if err := tx.QueryRow(`--sql
@@ -141,11 +351,85 @@ func createPermissionInstance(
 		values ($1, $2, nullif($3, ''))
 		returning id
 	`, system, permission, scope).Scan(&id); err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, dbError(err)
 	}
 	return id, nil
 }
 
+// Returns the permissions that the role gets from its superroles, directly or transitively, with the
+// superrole holding each instance.
+func (ui *UI) GetInheritedPermissions(ctx context.Context, id string) ([]models.HeldPermissionInstance, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		with recursive all_superroles (role_id) as (
+			select superrole_id from current_roles_roles
+			where subrole_id = $1
+			union
+			select superrole_id from all_superroles
+			inner join current_roles_roles
+				on subrole_id = role_id
+		)
+		select i.id, i.system_id, i.permission_id, coalesce(i.scope, ''), rp.role_id
+		from all_superroles a
+		inner join current_roles_permissions rp
+			using (role_id)
+		inner join permission_instances i
+			on i.id = rp.permission_instance_id
+		where rp.role_id != $1
+		order by i.system_id, i.permission_id, i.scope, rp.role_id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	var instances []models.HeldPermissionInstance
+	for rows.Next() {
+		var i models.HeldPermissionInstance
+		if err := rows.Scan(&i.ID, &i.SystemID, &i.PermissionID, &i.Scope, &i.RoleID); err != nil {
+			return nil, err
+		}
+		instances = append(instances, i)
+	}
+	return instances, rows.Err()
+}
+
+// Returns the permissions the user currently has, grouped by system. Permissions with several
+// scopes are listed once per scope.
+func (ui *UI) GetUserPermissions(ctx context.Context, kthID string) ([]models.SystemPermissionInstances, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		with recursive all_roles (role_id) as (
+			select role_id from roles_users
+			where kth_id = $1 and now() between start_date and end_date
+			union
+			select superrole_id from all_roles
+			inner join current_roles_roles
+				on subrole_id = role_id
+		)
+		select distinct i.system_id, i.permission_id, coalesce(i.scope, '')
+		from all_roles
+		inner join current_roles_permissions p
+			using (role_id)
+		inner join permission_instances i
+			on i.id = p.permission_instance_id
+		order by i.system_id, i.permission_id, coalesce(i.scope, '')
+	`, kthID)
+	if err != nil {
+		return nil, err
+	}
+	var result []models.SystemPermissionInstances
+	for rows.Next() {
+		var system string
+		var instance models.PermissionInstance
+		if err := rows.Scan(&system, &instance.PermissionID, &instance.Scope); err != nil {
+			return nil, err
+		}
+		if len(result) == 0 || result[len(result)-1].System != system {
+			result = append(result, models.SystemPermissionInstances{System: system})
+		}
+		last := &result[len(result)-1]
+		last.Permissions = append(last.Permissions, instance)
+	}
+	return result, rows.Err()
+}
+
 func (ui *UI) GetPermissions(ctx context.Context, system string) ([]models.Permission, error) {
 	rows, err := ui.db.QueryContext(ctx, `--sql
 		select id, has_scope
@@ -172,7 +456,7 @@ func (ui *UI) GetPermissions(ctx context.Context, system string) ([]models.Permi
 			return nil, err
 		}
 		if count == 0 {
-			return nil, errors.New("System does not exist")
+			return nil, notFound("No system with id " + system + ".")
 		}
 	}
 	return permissions, nil
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/datasektionen/pls4/models"
+	"github.com/google/uuid"
+)
+
+// Selects the current mandates in the role given by $1 and, if $2 is true, in all roles below it.
+const renewableMandatesQuery = `--sql
+	with recursive renewed_roles (role_id) as (
+		select $1::text
+		union
+		select subrole_id from renewed_roles
+		inner join current_roles_roles
+			on superrole_id = role_id
+		where $2
+	)
+	select
+		m.id, m.kth_id, m.modified_by, m.modified_at, m.start_date, m.end_date,
+		r.id, r.display_name
+	from renewed_roles
+	inner join roles_users m
+		using (role_id)
+	inner join roles r
+		on r.id = m.role_id
+	where now() between m.start_date and m.end_date
+	order by r.id = $1 desc, r.id, m.kth_id
+`
+
+// Returns the mandates that would be handed over by `RenewMandates`, i.e. the current mandates of
+// the role and, with `includeSubroles`, of every role below it.
+func (ui *UI) GetRenewableMandates(ctx context.Context, roleID string, includeSubroles bool) ([]models.Mandate, error) {
+	rows, err := ui.db.QueryContext(ctx, renewableMandatesQuery, roleID, includeSubroles)
+	if err != nil {
+		return nil, err
+	}
+	return scanMandates(rows)
+}
+
+// Hands over the role, and with `includeSubroles` every role below it, to the next term. All
+// current mandates in those roles that end after `endDate` are ended on it, and the members whose
+// mandates are listed in `renew` get a new mandate in the same role from `endDate` to
+// `nextEndDate`. Since a mandate stops being current at the start of its end date, the new one
+// starts on the same day so that nobody is left without the role in between. The new mandates are
+// upcoming until the term starts, so they can still be changed or removed like any other mandate.
+// Everything is done in one transaction, and `kthID` must be allowed to update every role
+// involved. Returns the number of mandates created, which leaves out members who already had a
+// mandate in the next term.
+func (ui *UI) RenewMandates(
+	ctx context.Context,
+	kthID, roleID string,
+	includeSubroles bool,
+	endDate, nextEndDate time.Time,
+	renew []uuid.UUID,
+) (int, error) {
+	if endDate.IsZero() {
+		return 0, invalid("A date to end the current mandates on is required.")
+	}
+	if !nextEndDate.After(endDate) {
+		return 0, invalid("The next term must end after the current one.")
+	}
+	nextStartDate := endDate
+	toRenew := make(map[uuid.UUID]struct{}, len(renew))
+	for _, memberID := range renew {
+		toRenew[memberID] = struct{}{}
+	}
+
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, renewableMandatesQuery, roleID, includeSubroles)
+	if err != nil {
+		return 0, err
+	}
+	mandates, err := scanMandates(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	checked := make(map[string]struct{})
+	listed, created := 0, 0
+	for _, mandate := range mandates {
+		if _, ok := checked[mandate.RoleID]; !ok {
+			if ok, err := ui.MayUpdateRole(ctx, kthID, mandate.RoleID); err != nil {
+				return 0, err
+			} else if !ok {
+				return 0, forbidden("You may not update the role " + mandate.RoleID + ".")
+			}
+			checked[mandate.RoleID] = struct{}{}
+		}
+
+		if mandate.EndDate.After(endDate) {
+			if endDate.Before(mandate.StartDate) {
+				return 0, invalid("The mandate of " + mandate.KTHID + " in " + mandate.RoleID + " starts after " + endDate.Format(time.DateOnly) + ".")
+			}
+			if err := updateMember(tx, kthID, mandate.RoleID, mandate.MemberID, time.Time{}, endDate); err != nil {
+				return 0, err
+			}
+		}
+
+		if _, ok := toRenew[mandate.MemberID]; !ok {
+			continue
+		}
+		listed++
+		// Mandates are current from the start of their start date to the start of their end date.
+		var exists bool
+		if err := tx.QueryRow(`--sql
+			select exists (
+				select 1 from roles_users
+				where role_id = $1 and kth_id = $2
+				and start_date < $4::date and end_date > $3::date
+			)
+		`, mandate.RoleID, mandate.KTHID, nextStartDate, nextEndDate).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists {
+			continue
+		}
+		if _, err := addMember(tx, kthID, mandate.RoleID, mandate.KTHID, nextStartDate, nextEndDate); err != nil {
+			return 0, err
+		}
+		created++
+	}
+	if listed != len(toRenew) {
+		return 0, invalid("Some of the mandates to renew are not current mandates in the renewed roles.")
+	}
+	return created, tx.Commit()
+}
@@ -2,7 +2,7 @@ package service
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"regexp"
 	"slices"
 	"strings"
@@ -41,7 +41,7 @@ func (ui *UI) ListRoles(ctx context.Context) ([]models.Role, error) {
 }
 
 func (ui *UI) GetRole(ctx context.Context, id string) (*models.Role, error) {
-	rows := ui.db.QueryRowContext(ctx, `--sql
+	row := ui.db.QueryRowContext(ctx, `--sql
 		select
 			r.id, r.display_name, r.description,
 			count(rr.subrole_id), count(ru.id)
@@ -52,21 +52,32 @@ func (ui *UI) GetRole(ctx context.Context, id string) (*models.Role, error) {
 		group by r.id
 	`, id)
 	var r models.Role
-	err := rows.Scan(&r.ID, &r.DisplayName, &r.Description, &r.SubroleCount, &r.MemberCount)
-	if r.ID == "" {
-		return nil, nil
+	if err := row.Scan(
+		&r.ID, &r.DisplayName, &r.Description, &r.SubroleCount, &r.MemberCount,
+	); err == sql.ErrNoRows {
+		return nil, notFound("No role with id " + id + ".")
+	} else if err != nil {
+		return nil, err
 	}
-	return &r, err
+	return &r, nil
 }
 
 func (ui *UI) UpdateRole(ctx context.Context, kthID, roleID, displayName, description string) error {
 	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not update the role " + roleID + ".")
 	}
-	res, err := ui.db.ExecContext(ctx, `--sql
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := snapshot(tx, roleSnapshot, roleID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`--sql
 		update roles
 		set
 			display_name = coalesce(nullif($2, ''), display_name),
@@ -81,9 +92,19 @@ func (ui *UI) UpdateRole(ctx context.Context, kthID, roleID, displayName, descri
 		return err
 	}
 	if n != 1 {
-		// TODO: invalid id
+		return notFound("No role with id " + roleID + ".")
+	}
+	after, err := snapshot(tx, roleSnapshot, roleID)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "update-role", roleID: roleID, target: roleID,
+		before: before, after: after,
+	}); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 func (ui *UI) CreateRole(
@@ -93,13 +114,19 @@ func (ui *UI) CreateRole(
 	if ok, err := ui.MayCreateRoles(ctx, kthID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not create roles.")
 	}
-	if roles, err := ui.GetUserRoles(ctx, kthID); err != nil {
+	if strings.HasPrefix(kthID, tokenActorPrefix) {
+		// Tokens don't have roles, so they may instead give the new role to any role they may update.
+		if ok, err := ui.MayUpdateRole(ctx, kthID, ownerID); err != nil {
+			return err
+		} else if !ok {
+			return forbidden("You may not update the role " + ownerID + ", so it can not manage the new role.")
+		}
+	} else if roles, err := ui.GetUserRoles(ctx, kthID); err != nil {
 		return err
 	} else if !slices.ContainsFunc(roles, func(role models.Role) bool { return role.ID == ownerID }) {
-		return errors.New("The user does not have the role " + ownerID + ".")
+		return invalid("You do not have the role " + ownerID + ".")
 	}
 	tx, err := ui.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -110,7 +137,7 @@ func (ui *UI) CreateRole(
 		insert into roles (id, display_name, description)
 		values ($1, $2, $3)
 	`, id, displayName, description); err != nil {
-		return err
+		return dbError(err)
 	}
 	var instanceID uuid.UUID
 	if err := tx.QueryRow(`--sql
@@ -124,6 +151,25 @@ func (ui *UI) CreateRole(
 		insert into roles_permissions (permission_instance_id, role_id)
 		values ($1, $2)
 	`, instanceID, ownerID); err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, roleSnapshot, id)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "create-role", roleID: id, target: id, after: after,
+	}); err != nil {
+		return err
+	}
+	instance, err := snapshot(tx, permissionInstanceSnapshot, instanceID)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "add-permission", roleID: ownerID, systemID: "pls",
+		target: instanceID.String(), after: instance,
+	}); err != nil {
 		return err
 	}
 	return tx.Commit()
@@ -138,21 +184,50 @@ func (ui *UI) DeleteRole(
 	if ok, err := ui.MayDeleteRole(ctx, kthID, roleID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not delete the role " + roleID + ".")
 	}
 	tx, err := ui.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(`--sql
-		delete from roles_roles
+	before, err := snapshot(tx, roleSnapshot, roleID)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return notFound("No role with id " + roleID + ".")
+	}
+	rows, err := tx.Query(`--sql
+		delete from roles_roles rr
 		where subrole_id = $1
+		returning superrole_id, to_jsonb(rr)
 	`, roleID)
 	if err != nil {
 		return err
 	}
+	type link struct {
+		superroleID string
+		before      []byte
+	}
+	var links []link
+	for rows.Next() {
+		var l link
+		if err := rows.Scan(&l.superroleID, &l.before); err != nil {
+			return err
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, l := range links {
+		if err := audit(tx, kthID, auditEntry{
+			action: "remove-subrole", roleID: l.superroleID, target: roleID, before: l.before,
+		}); err != nil {
+			return err
+		}
+	}
 	_, err = tx.Exec(`--sql
 		delete from roles
 		where id = $1
@@ -161,21 +236,62 @@ func (ui *UI) DeleteRole(
 		match := tableRexeg.FindStringSubmatch(err.Error())
 		if len(match) > 1 {
 			table := match[1]
-			return errors.New("This role still has " + table + " connected. They must be removed first.")
+			return conflict("This role still has " + table + " connected. They must be removed first.")
 		}
 	}
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(`--sql
-		delete from permission_instances
-		where system_id = 'pls'
-		and permission_id = 'role'
-		and scope = $1
+	rows, err = tx.Query(`--sql
+		select i.id, coalesce(rp.role_id, '')
+		from permission_instances i
+		left join roles_permissions rp
+			on rp.permission_instance_id = i.id
+		where i.system_id = 'pls'
+		and i.permission_id = 'role'
+		and i.scope = $1
 	`, roleID)
 	if err != nil {
 		return err
 	}
+	type instance struct {
+		id     uuid.UUID
+		roleID string
+	}
+	var instances []instance
+	for rows.Next() {
+		var i instance
+		if err := rows.Scan(&i.id, &i.roleID); err != nil {
+			return err
+		}
+		instances = append(instances, i)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, i := range instances {
+		before, err := snapshot(tx, permissionInstanceSnapshot, i.id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`--sql
+			delete from permission_instances
+			where id = $1
+		`, i.id); err != nil {
+			return err
+		}
+		if err := audit(tx, kthID, auditEntry{
+			action: "remove-permission", roleID: i.roleID, systemID: "pls",
+			target: i.id.String(), before: before,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "delete-role", roleID: roleID, target: roleID, before: before,
+	}); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -14,9 +14,18 @@ type UI struct {
 	loginFrontendURL string
 	loginAPIURL      string
 	loginAPIKey      string
+	notifier         Notifier
+	expiryNoticeDays int
 }
 
-func New(ctx context.Context, db *sql.DB, api *api.API, loginFrontendURL, loginAPIURL, loginAPIKey string) *UI {
+func New(
+	ctx context.Context,
+	db *sql.DB,
+	api *api.API,
+	loginFrontendURL, loginAPIURL, loginAPIKey string,
+	notifier Notifier,
+	expiryNoticeDays int,
+) *UI {
 	s := &UI{}
 
 	s.api = api
@@ -24,8 +33,12 @@ func New(ctx context.Context, db *sql.DB, api *api.API, loginFrontendURL, loginA
 	s.loginAPIURL = loginAPIURL
 	s.loginAPIKey = loginAPIKey
 	s.db = db
+	s.notifier = notifier
+	s.expiryNoticeDays = expiryNoticeDays
 
 	go s.deleteOldSessionsForever(ctx)
+	go s.notifyExpiringMandatesForever(ctx)
+	go s.deliverWebhooksForever(ctx)
 
 	return s
 }
@@ -44,7 +57,7 @@ func (ui *UI) GetUserRoles(
 			where kth_id = $1 and now() between start_date and end_date
 			union
 			select superrole_id from all_roles
-			inner join roles_roles
+			inner join current_roles_roles
 				on subrole_id = role_id
 		)
 		select r.id, r.display_name
@@ -2,53 +2,248 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/datasektionen/pls4/models"
 )
 
-func (ui *UI) GetSubroles(ctx context.Context, id string) ([]models.Role, error) {
+func (ui *UI) GetSubroles(ctx context.Context, id string) ([]models.LinkedRole, error) {
 	rows, err := ui.db.QueryContext(ctx, `--sql
 		select
 			r.id, r.display_name, r.description,
-			count(sub.subrole_id), count(ru.id)
+			count(sub.subrole_id), count(ru.id),
+			rr.start_date, rr.end_date
 		from roles_roles rr
 		inner join roles r on r.id = rr.subrole_id
 		left join roles_roles sub on sub.superrole_id = r.id
 		left join roles_users ru on ru.role_id = r.id
 		where rr.superrole_id = $1
-		group by r.id
+		group by r.id, rr.start_date, rr.end_date
 	`, id)
 	if err != nil {
 		return nil, err
 	}
-	var roles []models.Role
+	return scanLinkedRoles(rows)
+}
+
+// Returns the roles that the role is a direct subrole of.
+func (ui *UI) GetSuperroles(ctx context.Context, id string) ([]models.LinkedRole, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select
+			r.id, r.display_name, r.description,
+			count(distinct sub.subrole_id), count(distinct ru.id),
+			rr.start_date, rr.end_date
+		from roles_roles rr
+		inner join roles r on r.id = rr.superrole_id
+		left join roles_roles sub on sub.superrole_id = r.id
+		left join roles_users ru on ru.role_id = r.id
+		where rr.subrole_id = $1
+		group by r.id, rr.start_date, rr.end_date
+		order by r.display_name
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinkedRoles(rows)
+}
+
+// Scans rows of (id, display_name, description, subrole_count, member_count, start_date, end_date).
+func scanLinkedRoles(rows *sql.Rows) ([]models.LinkedRole, error) {
+	var roles []models.LinkedRole
 	for rows.Next() {
-		var r models.Role
+		var r models.LinkedRole
+		var startDate, endDate sql.NullTime
 		if err := rows.Scan(
 			&r.ID, &r.DisplayName, &r.Description,
 			&r.SubroleCount, &r.MemberCount,
+			&startDate, &endDate,
 		); err != nil {
 			return nil, err
 		}
+		r.StartDate = startDate.Time
+		r.EndDate = endDate.Time
 		roles = append(roles, r)
 	}
-	return roles, nil
+	return roles, rows.Err()
+}
+
+// Returns all roles, including those without current members, and the subrole links between them
+// that are in effect right now.
+func (ui *UI) GetRoleHierarchy(ctx context.Context) (*models.RoleHierarchy, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select
+			r.id, r.display_name, r.description,
+			(select count(*) from current_roles_roles where superrole_id = r.id),
+			(select count(*) from roles_users where role_id = r.id and now() between start_date and end_date)
+		from roles r
+		order by r.display_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(
+			&role.ID, &role.DisplayName, &role.Description,
+			&role.SubroleCount, &role.MemberCount,
+		); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows, err = ui.db.QueryContext(ctx, `--sql
+		select superrole_id, subrole_id
+		from current_roles_roles
+		order by superrole_id, subrole_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	hierarchy := models.RoleHierarchy{Roles: roles, Links: []models.SubroleLink{}}
+	for rows.Next() {
+		var link models.SubroleLink
+		if err := rows.Scan(&link.SuperroleID, &link.SubroleID); err != nil {
+			return nil, err
+		}
+		hierarchy.Links = append(hierarchy.Links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &hierarchy, nil
 }
 
-func (ui *UI) AddSubrole(ctx context.Context, kthID, roleID, subroleID string) error {
+// Makes `subroleID` a subrole of `roleID` between the given dates. Zero dates make the link
+// unbounded in that direction.
+func (ui *UI) AddSubrole(ctx context.Context, kthID, roleID, subroleID string, startDate, endDate time.Time) error {
 	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not update the role " + roleID + ".")
 	}
-	_, err := ui.db.ExecContext(ctx, `--sql
-		insert into roles_roles (superrole_id, subrole_id)
-		values ($1, $2)
-	`, roleID, subroleID)
+	tx, err := ui.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+	if !startDate.IsZero() && !endDate.IsZero() && endDate.Before(startDate) {
+		return invalid("The end date may not be before the start date.")
+	}
+	if err := checkNoCycle(tx, roleID, subroleID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`--sql
+		insert into roles_roles (superrole_id, subrole_id, start_date, end_date)
+		values ($1, $2, $3, $4)
+	`,
+		roleID, subroleID,
+		sql.NullTime{Time: startDate, Valid: !startDate.IsZero()},
+		sql.NullTime{Time: endDate, Valid: !endDate.IsZero()},
+	); err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, subroleSnapshot, roleID, subroleID)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "add-subrole", roleID: roleID, target: subroleID, after: after,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Sets when `subroleID` is a subrole of `roleID`. Nil dates are left unchanged, and zero dates
+// make the link unbounded in that direction.
+func (ui *UI) UpdateSubroleDates(ctx context.Context, kthID, roleID, subroleID string, startDate, endDate *time.Time) error {
+	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
+		return err
+	} else if !ok {
+		return forbidden("You may not update the role " + roleID + ".")
+	}
+	if startDate != nil && endDate != nil && !startDate.IsZero() && !endDate.IsZero() && endDate.Before(*startDate) {
+		return invalid("The end date may not be before the start date.")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := snapshot(tx, subroleSnapshot, roleID, subroleID)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return notFound("The role " + subroleID + " is not a subrole of " + roleID + ".")
+	}
+	if _, err := tx.Exec(`--sql
+		update roles_roles
+		set
+			start_date = case when $3 then $4 else start_date end,
+			end_date = case when $5 then $6 else end_date end
+		where superrole_id = $1 and subrole_id = $2
+	`,
+		roleID, subroleID,
+		startDate != nil, optionalDate(startDate),
+		endDate != nil, optionalDate(endDate),
+	); err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, subroleSnapshot, roleID, subroleID)
+	if err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "update-subrole", roleID: roleID, target: subroleID, before: before, after: after,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Returns a nil or zero date as null and any other date as itself.
+func optionalDate(date *time.Time) sql.NullTime {
+	if date == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *date, Valid: !date.IsZero()}
+}
+
+// Returns an error if making `subroleID` a subrole of `roleID` would make a role (transitively) a
+// subrole of itself. Locks roles_roles against concurrent changes for the rest of the
+// transaction, since two links that are fine on their own could otherwise form a cycle together.
+func checkNoCycle(tx *sql.Tx, roleID, subroleID string) error {
+	if roleID == subroleID {
+		return invalid("A role can not be a subrole of itself.")
+	}
+	if _, err := tx.Exec(`--sql
+		lock table roles_roles in share row exclusive mode
+	`); err != nil {
+		return err
+	}
+	var cycle bool
+	if err := tx.QueryRow(`--sql
+		with recursive all_subroles (role_id) as (
+			select $1::text
+			union
+			select subrole_id from all_subroles
+			inner join roles_roles
+				on superrole_id = role_id
+		)
+		select exists (select 1 from all_subroles where role_id = $2)
+	`, subroleID, roleID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return conflict("The role " + roleID + " is already a subrole of " + subroleID + ", so adding " +
+			subroleID + " as a subrole of " + roleID + " would create a cycle.")
+	}
 	return nil
 }
 
@@ -56,10 +251,18 @@ func (ui *UI) RemoveSubrole(ctx context.Context, kthID, roleID, subroleID string
 	if ok, err := ui.MayUpdateRole(ctx, kthID, roleID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return an error
-		return nil
+		return forbidden("You may not update the role " + roleID + ".")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	res, err := ui.db.ExecContext(ctx, `--sql
+	defer tx.Rollback()
+	before, err := snapshot(tx, subroleSnapshot, roleID, subroleID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`--sql
 		delete from roles_roles
 		where superrole_id = $1 and subrole_id = $2
 	`, roleID, subroleID)
@@ -71,8 +274,12 @@ func (ui *UI) RemoveSubrole(ctx context.Context, kthID, roleID, subroleID string
 		return err
 	}
 	if n != 1 {
-		// TODO: invalid roleID didn't have subroleID as a subrole
+		return notFound("The role " + subroleID + " is not a subrole of " + roleID + ".")
 	}
-	return nil
+	if err := audit(tx, kthID, auditEntry{
+		action: "remove-subrole", roleID: roleID, target: subroleID, before: before,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
-
@@ -1,6 +1,9 @@
 package service
 
-import "context"
+import (
+	"context"
+	"database/sql"
+)
 
 func (ui *UI) GetAllSystems(ctx context.Context) ([]string, error) {
 	rows, err := ui.db.QueryContext(ctx, `--sql
@@ -22,118 +25,208 @@ func (ui *UI) CreateSystem(ctx context.Context, id, kthID string) error {
 	if ok, err := ui.MayCreateSystems(ctx, kthID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return forbidden or something
-		return nil
+		return forbidden("You may not create systems.")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	if _, err := ui.db.ExecContext(ctx, `--sql
+	defer tx.Rollback()
+	if _, err := tx.Exec(`--sql
 		insert into systems (id)
 		values ($1)
 	`, id); err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, systemSnapshot, id)
+	if err != nil {
 		return err
 	}
-	return nil
+	if err := audit(tx, kthID, auditEntry{
+		action: "create-system", systemID: id, target: id, after: after,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (ui *UI) DeleteSystem(ctx context.Context, id, kthID string) error {
 	if ok, err := ui.MayDeleteSystems(ctx, kthID); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return forbidden or something
-		return nil
+		return forbidden("You may not delete systems.")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := snapshot(tx, systemSnapshot, id)
+	if err != nil {
+		return err
 	}
-	if _, err := ui.db.ExecContext(ctx, `--sql
+	if before == nil {
+		return notFound("No system with id " + id + ".")
+	}
+	if _, err := tx.Exec(`--sql
 		delete from systems
 		where id = $1
 	`, id); err != nil {
+		return dbError(err)
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "delete-system", systemID: id, target: id, before: before,
+	}); err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 func (ui *UI) CreatePermission(ctx context.Context, system, permission string, hasScope bool, kthID string) error {
+	return ui.updatePermissionsInSystem(ctx, kthID, system, func(tx *sql.Tx) error {
+		return createPermission(tx, kthID, system, permission, hasScope)
+	})
+}
+
+func (ui *UI) DeletePermission(ctx context.Context, system, permission, kthID string) error {
+	return ui.updatePermissionsInSystem(ctx, kthID, system, func(tx *sql.Tx) error {
+		return deletePermission(tx, kthID, system, permission)
+	})
+}
+
+func (ui *UI) AddScopeToPermission(ctx context.Context, system, permission, defaultScope, kthID string) error {
+	return ui.updatePermissionsInSystem(ctx, kthID, system, func(tx *sql.Tx) error {
+		return addScopeToPermission(tx, kthID, system, permission, defaultScope)
+	})
+}
+
+func (ui *UI) RemoveScopeFromPermission(ctx context.Context, system, permission, kthID string) error {
+	return ui.updatePermissionsInSystem(ctx, kthID, system, func(tx *sql.Tx) error {
+		return removeScopeFromPermission(tx, kthID, system, permission)
+	})
+}
+
+// Checks that the user may update permissions in the system and runs `update` in a transaction,
+// which is committed if it succeeds.
+func (ui *UI) updatePermissionsInSystem(ctx context.Context, kthID, system string, update func(tx *sql.Tx) error) error {
 	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
 		return err
 	} else if !ok {
-		// TODO: return forbidden or something
-		return nil
+		return forbidden("You may not update permissions in the system " + system + ".")
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := update(tx); err != nil {
+		return err
 	}
-	if _, err := ui.db.ExecContext(ctx, `--sql
+	return tx.Commit()
+}
+
+func createPermission(tx *sql.Tx, kthID, system, permission string, hasScope bool) error {
+	if _, err := tx.Exec(`--sql
 		insert into permissions (system_id, id, has_scope)
 		values ($1, $2, $3)
 	`, system, permission, hasScope); err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, permissionSnapshot, system, permission)
+	if err != nil {
 		return err
 	}
-	return nil
+	return audit(tx, kthID, auditEntry{
+		action: "create-permission", systemID: system, target: permission, after: after,
+	})
 }
 
-func (ui *UI) DeletePermission(ctx context.Context, system, permission, kthID string) error {
-	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
+func deletePermission(tx *sql.Tx, kthID, system, permission string) error {
+	before, err := snapshot(tx, permissionSnapshot, system, permission)
+	if err != nil {
 		return err
-	} else if !ok {
-		// TODO: return forbidden or something
-		return nil
 	}
-	if _, err := ui.db.ExecContext(ctx, `--sql
+	if before == nil {
+		return notFound("No permission " + permission + " in the system " + system + ".")
+	}
+	if _, err := tx.Exec(`--sql
 		delete from permissions
 		where system_id = $1
 		and id = $2
 	`, system, permission); err != nil {
-		return err
+		return dbError(err)
 	}
-	return nil
+	return audit(tx, kthID, auditEntry{
+		action: "delete-permission", systemID: system, target: permission, before: before,
+	})
 }
 
-func (ui *UI) AddScopeToPermission(ctx context.Context, system, permission, defaultScope, kthID string) error {
-	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
-		return err
-	} else if !ok {
-		// TODO: return forbidden or something
-		return nil
-	}
-	tx, err := ui.db.BeginTx(ctx, nil)
+func addScopeToPermission(tx *sql.Tx, kthID, system, permission, defaultScope string) error {
+	before, err := snapshot(tx, permissionSnapshot, system, permission)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-	if _, err := tx.Exec(`--sql
+	if before == nil {
+		return notFound("No permission " + permission + " in the system " + system + ".")
+	}
+	res, err := tx.Exec(`--sql
 		update permissions
 		set has_scope = true
 		where system_id = $1
 		and id = $2
-	`, system, permission); err != nil {
+		and not has_scope
+	`, system, permission)
+	if err != nil {
 		return err
 	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		// The permission already has a scope, so there is nothing to do.
+		return nil
+	}
 	if _, err := tx.Exec(`--sql
 		update permission_instances
 		set scope = $3
 		where system_id = $1
 		and permission_id = $2
 	`, system, permission, defaultScope); err != nil {
+		return dbError(err)
+	}
+	after, err := snapshot(tx, permissionSnapshot, system, permission)
+	if err != nil {
 		return err
 	}
-	return tx.Commit()
+	return audit(tx, kthID, auditEntry{
+		action: "add-scope", systemID: system, target: permission,
+		before: before, after: after,
+	})
 }
 
-func (ui *UI) RemoveScopeFromPermission(ctx context.Context, system, permission, kthID string) error {
-	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, kthID, system); err != nil {
-		return err
-	} else if !ok {
-		// TODO: return forbidden or something
-		return nil
-	}
-	tx, err := ui.db.BeginTx(ctx, nil)
+func removeScopeFromPermission(tx *sql.Tx, kthID, system, permission string) error {
+	before, err := snapshot(tx, permissionSnapshot, system, permission)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-	if _, err := tx.Exec(`--sql
+	if before == nil {
+		return notFound("No permission " + permission + " in the system " + system + ".")
+	}
+	res, err := tx.Exec(`--sql
 		update permissions
 		set has_scope = false
 		where system_id = $1
 		and id = $2
-	`, system, permission); err != nil {
+		and has_scope
+	`, system, permission)
+	if err != nil {
 		return err
 	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		// The permission already has no scope, so there is nothing to do.
+		return nil
+	}
 	if _, err := tx.Exec(`--sql
 		update permission_instances
 		set scope = null
@@ -142,5 +235,12 @@ func (ui *UI) RemoveScopeFromPermission(ctx context.Context, system, permission,
 	`, system, permission); err != nil {
 		return err
 	}
-	return tx.Commit()
+	after, err := snapshot(tx, permissionSnapshot, system, permission)
+	if err != nil {
+		return err
+	}
+	return audit(tx, kthID, auditEntry{
+		action: "remove-scope", systemID: system, target: permission,
+		before: before, after: after,
+	})
 }
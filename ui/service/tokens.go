@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/datasektionen/pls4/models"
+	"github.com/google/uuid"
+)
+
+var errMayNotManageTokens = forbidden("You may not manage api tokens.")
+
+func (ui *UI) ListTokens(ctx context.Context) ([]models.APIToken, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select id, description, created_at, expires_at, last_used_at
+		from api_tokens
+		order by created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []models.APIToken
+	for rows.Next() {
+		var token models.APIToken
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(
+			&token.ID, &token.Description, &token.CreatedAt,
+			&expiresAt, &lastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		token.ExpiresAt = expiresAt.Time
+		token.LastUsedAt = lastUsedAt.Time
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// Returns the api token with the given id.
+func (ui *UI) GetToken(ctx context.Context, tokenID uuid.UUID) (*models.APIToken, error) {
+	var token models.APIToken
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := ui.db.QueryRowContext(ctx, `--sql
+		select id, description, created_at, expires_at, last_used_at
+		from api_tokens
+		where id = $1
+	`, tokenID).Scan(
+		&token.ID, &token.Description, &token.CreatedAt,
+		&expiresAt, &lastUsedAt,
+	); err == sql.ErrNoRows {
+		return nil, notFound("No api token with id " + tokenID.String() + ".")
+	} else if err != nil {
+		return nil, err
+	}
+	token.ExpiresAt = expiresAt.Time
+	token.LastUsedAt = lastUsedAt.Time
+	return &token, nil
+}
+
+// Creates a new api token and returns its secret. This is the only time the secret is returned.
+func (ui *UI) CreateToken(ctx context.Context, kthID, description string, expiresAt time.Time) (uuid.UUID, error) {
+	if ok, err := ui.MayManageTokens(ctx, kthID); err != nil {
+		return uuid.Nil, err
+	} else if !ok {
+		return uuid.Nil, errMayNotManageTokens
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	var id, secret uuid.UUID
+	if err := tx.QueryRow(`--sql
+		insert into api_tokens (description, expires_at)
+		values ($1, $2)
+		returning id, secret
+	`, description, sql.NullTime{Time: expiresAt, Valid: expiresAt != time.Time{}}).Scan(&id, &secret); err != nil {
+		return uuid.Nil, err
+	}
+	after, err := snapshot(tx, tokenSnapshot, id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "create-token", target: id.String(), after: after,
+	}); err != nil {
+		return uuid.Nil, err
+	}
+	return secret, tx.Commit()
+}
+
+// Replaces the secret of an api token with a new one, which is returned.
+func (ui *UI) RotateToken(ctx context.Context, kthID string, tokenID uuid.UUID) (uuid.UUID, error) {
+	if ok, err := ui.MayManageTokens(ctx, kthID); err != nil {
+		return uuid.Nil, err
+	} else if !ok {
+		return uuid.Nil, errMayNotManageTokens
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	var secret uuid.UUID
+	if err := tx.QueryRow(`--sql
+		update api_tokens
+		set secret = gen_random_uuid()
+		where id = $1
+		returning secret
+	`, tokenID).Scan(&secret); err == sql.ErrNoRows {
+		return uuid.Nil, notFound("No api token with id " + tokenID.String() + ".")
+	} else if err != nil {
+		return uuid.Nil, err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "rotate-token", target: tokenID.String(),
+	}); err != nil {
+		return uuid.Nil, err
+	}
+	return secret, tx.Commit()
+}
+
+func (ui *UI) DeleteToken(ctx context.Context, kthID string, tokenID uuid.UUID) error {
+	if ok, err := ui.MayManageTokens(ctx, kthID); err != nil {
+		return err
+	} else if !ok {
+		return errMayNotManageTokens
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := snapshot(tx, tokenSnapshot, tokenID)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return notFound("No api token with id " + tokenID.String() + ".")
+	}
+	rows, err := tx.Query(`--sql
+		select i.id, i.system_id
+		from api_tokens_permissions tp
+		inner join permission_instances i
+			on i.id = tp.permission_instance_id
+		where tp.api_token_id = $1
+	`, tokenID)
+	if err != nil {
+		return err
+	}
+	type instance struct {
+		id     uuid.UUID
+		system string
+	}
+	var instances []instance
+	for rows.Next() {
+		var i instance
+		if err := rows.Scan(&i.id, &i.system); err != nil {
+			return err
+		}
+		instances = append(instances, i)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, i := range instances {
+		before, err := snapshot(tx, permissionInstanceSnapshot, i.id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`--sql
+			delete from api_tokens_permissions
+			where permission_instance_id = $1
+		`, i.id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`--sql
+			delete from permission_instances
+			where id = $1
+		`, i.id); err != nil {
+			return err
+		}
+		if err := audit(tx, kthID, auditEntry{
+			action: "remove-permission", systemID: i.system,
+			target: i.id.String(), before: before,
+		}); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`--sql
+		delete from api_tokens
+		where id = $1
+	`, tokenID); err != nil {
+		return err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "delete-token", target: tokenID.String(), before: before,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
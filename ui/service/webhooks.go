@@ -0,0 +1,380 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/datasektionen/pls4/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Events that webhooks can subscribe to. All but the last two are sent when the change is made,
+// and the last two when the start or end date of a mandate has passed.
+var WebhookEvents = []string{
+	"add-member", "update-member", "remove-member",
+	"add-subrole", "update-subrole", "remove-subrole",
+	"add-permission", "update-permission", "remove-permission",
+	"mandate-started", "mandate-ended",
+}
+
+const (
+	// Deliveries are given up after this many failed attempts.
+	MaxWebhookAttempts = 10
+	// Started and ended mandates are only reported if their dates passed at most this long ago,
+	// so that not every mandate that has ever ended is reported when webhooks are first set up.
+	mandateEventLookback = 7 * 24 * time.Hour
+	// Delivered events are deleted after this long.
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+)
+
+var errMayNotManageWebhooks = forbidden("You may not manage webhooks.")
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (ui *UI) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select id, url, description, events, created_at
+		from webhooks
+		order by created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var webhooks []models.Webhook
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := rows.Scan(
+			&webhook.ID, &webhook.URL, &webhook.Description,
+			pq.Array(&webhook.Events), &webhook.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (ui *UI) GetWebhook(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := ui.db.QueryRowContext(ctx, `--sql
+		select id, url, description, events, created_at
+		from webhooks
+		where id = $1
+	`, webhookID).Scan(
+		&webhook.ID, &webhook.URL, &webhook.Description,
+		pq.Array(&webhook.Events), &webhook.CreatedAt,
+	); err == sql.ErrNoRows {
+		return nil, notFound("No webhook with id " + webhookID.String() + ".")
+	} else if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Returns the latest deliveries to the webhook, newest first.
+func (ui *UI) GetWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := ui.db.QueryContext(ctx, `--sql
+		select
+			id, event, payload, created_at, attempts, next_attempt_at,
+			delivered_at, coalesce(last_status, 0), coalesce(last_error, '')
+		from webhook_deliveries
+		where webhook_id = $1
+		order by id desc
+		limit $2
+	`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(
+			&d.ID, &d.Event, &d.Payload, &d.CreatedAt, &d.Attempts, &d.NextAttemptAt,
+			&deliveredAt, &d.LastStatus, &d.LastError,
+		); err != nil {
+			return nil, err
+		}
+		d.DeliveredAt = deliveredAt.Time
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Creates a webhook and returns the secret its requests are signed with. This is the only time
+// the secret is returned.
+func (ui *UI) CreateWebhook(ctx context.Context, kthID, webhookURL, description string, events []string) (uuid.UUID, error) {
+	if ok, err := ui.MayManageWebhooks(ctx, kthID); err != nil {
+		return uuid.Nil, err
+	} else if !ok {
+		return uuid.Nil, errMayNotManageWebhooks
+	}
+	if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return uuid.Nil, invalid("The url must be an absolute http or https url.")
+	}
+	if len(events) == 0 {
+		return uuid.Nil, invalid("At least one event is required.")
+	}
+	for _, event := range events {
+		if !slices.Contains(WebhookEvents, event) {
+			return uuid.Nil, invalid("Unknown event " + event + ".")
+		}
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	var id, secret uuid.UUID
+	if err := tx.QueryRow(`--sql
+		insert into webhooks (url, description, events)
+		values ($1, $2, $3)
+		returning id, secret
+	`, webhookURL, description, pq.Array(events)).Scan(&id, &secret); err != nil {
+		return uuid.Nil, err
+	}
+	after, err := snapshot(tx, webhookSnapshot, id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "create-webhook", target: id.String(), after: after,
+	}); err != nil {
+		return uuid.Nil, err
+	}
+	return secret, tx.Commit()
+}
+
+// Deletes the webhook together with its delivery log, including events not yet delivered.
+func (ui *UI) DeleteWebhook(ctx context.Context, kthID string, webhookID uuid.UUID) error {
+	if ok, err := ui.MayManageWebhooks(ctx, kthID); err != nil {
+		return err
+	} else if !ok {
+		return errMayNotManageWebhooks
+	}
+	tx, err := ui.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := snapshot(tx, webhookSnapshot, webhookID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`--sql
+		delete from webhooks
+		where id = $1
+	`, webhookID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return notFound("No webhook with id " + webhookID.String() + ".")
+	}
+	if err := audit(tx, kthID, auditEntry{
+		action: "delete-webhook", target: webhookID.String(), before: before,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Schedules a delivery that has been given up on to be attempted again.
+func (ui *UI) RetryWebhookDelivery(ctx context.Context, kthID string, webhookID uuid.UUID, deliveryID int64) error {
+	if ok, err := ui.MayManageWebhooks(ctx, kthID); err != nil {
+		return err
+	} else if !ok {
+		return errMayNotManageWebhooks
+	}
+	res, err := ui.db.ExecContext(ctx, `--sql
+		update webhook_deliveries
+		set attempts = 0, next_attempt_at = now()
+		where id = $1 and webhook_id = $2 and delivered_at is null
+	`, deliveryID, webhookID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return notFound("No undelivered event with id " + strconv.FormatInt(deliveryID, 10) + ".")
+	}
+	return nil
+}
+
+func (ui *UI) deliverWebhooksForever(ctx context.Context) {
+loop:
+	for {
+		if err := ui.queueMandateEvents(ctx); err != nil {
+			slog.Error("Could not queue mandate events for webhooks", "error", err)
+		}
+		if err := ui.deliverWebhooks(ctx); err != nil {
+			slog.Error("Could not deliver webhooks", "error", err)
+		}
+		if _, err := ui.db.ExecContext(ctx, `--sql
+			delete from webhook_deliveries
+			where delivered_at < now() - make_interval(secs => $1)
+		`, webhookDeliveryRetention.Seconds()); err != nil {
+			slog.Error("Could not delete old webhook deliveries", "error", err)
+		}
+		select {
+		case <-time.After(10 * time.Second):
+			continue
+		case <-ctx.Done():
+			break loop
+		}
+	}
+}
+
+// Queues `mandate-started` and `mandate-ended` events for mandates whose start or end date has been
+// reached since they were last reported. A mandate stops granting permissions at the start of its
+// end date, so that is also when it is reported as ended.
+func (ui *UI) queueMandateEvents(ctx context.Context) error {
+	_, err := ui.db.ExecContext(ctx, `--sql
+		with crossed (member_id, event, date, role_id, mandate) as (
+			select id, 'mandate-started', start_date, role_id, to_jsonb(m)
+			from roles_users m
+			where start_date <= now()
+			and start_date > now() - make_interval(secs => $1)
+			union all
+			select id, 'mandate-ended', end_date, role_id, to_jsonb(m)
+			from roles_users m
+			where end_date <= now()
+			and end_date > now() - make_interval(secs => $1)
+		), reported as (
+			insert into webhook_mandate_events (member_id, event, date)
+			select member_id, event, date from crossed
+			on conflict do nothing
+			returning member_id, event, date
+		)
+		insert into webhook_deliveries (webhook_id, event, payload)
+		select w.id, c.event, jsonb_build_object(
+			'event', c.event, 'created_at', now()::timestamp, 'actor', null,
+			'role_id', c.role_id, 'system_id', null, 'target', c.member_id,
+			'before', null, 'after', c.mandate
+		)
+		from reported
+		inner join crossed c
+			using (member_id, event, date)
+		inner join webhooks w
+			on c.event = any(w.events)
+	`, mandateEventLookback.Seconds())
+	if err != nil {
+		return err
+	}
+	_, err = ui.db.ExecContext(ctx, `--sql
+		delete from webhook_mandate_events
+		where date < now() - make_interval(secs => $1)
+	`, mandateEventLookback.Seconds())
+	return err
+}
+
+// Attempts to deliver every event that is due. Each delivery is claimed by pushing its next
+// attempt into the future before it is sent, so that several instances can run this at once.
+func (ui *UI) deliverWebhooks(ctx context.Context) error {
+	for {
+		rows, err := ui.db.QueryContext(ctx, `--sql
+			update webhook_deliveries d
+			set next_attempt_at = now() + interval '1 minute'
+			from webhooks w
+			where w.id = d.webhook_id
+			and d.id in (
+				select id from webhook_deliveries
+				where delivered_at is null and attempts < $1 and next_attempt_at <= now()
+				order by id
+				limit 50
+				for update skip locked
+			)
+			returning d.id, d.event, d.payload, w.url, w.secret
+		`, MaxWebhookAttempts)
+		if err != nil {
+			return err
+		}
+		type delivery struct {
+			id      int64
+			event   string
+			payload []byte
+			url     string
+			secret  uuid.UUID
+		}
+		var deliveries []delivery
+		for rows.Next() {
+			var d delivery
+			if err := rows.Scan(&d.id, &d.event, &d.payload, &d.url, &d.secret); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		for _, d := range deliveries {
+			status, err := sendWebhook(ctx, d.url, d.secret, d.id, d.event, d.payload)
+			var lastError sql.NullString
+			if err != nil {
+				lastError = sql.NullString{String: err.Error(), Valid: true}
+			}
+			if _, err := ui.db.ExecContext(ctx, `--sql
+				update webhook_deliveries
+				set
+					attempts = attempts + 1,
+					last_status = nullif($2, 0),
+					last_error = $3,
+					delivered_at = case when $3::text is null then now() end,
+					next_attempt_at = now() + make_interval(mins => power(2, attempts)::int)
+				where id = $1
+			`, d.id, status, lastError); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Posts the payload to the url. The request is signed with an HMAC-SHA256 using the secret of the
+// timestamp in `X-Pls-Timestamp`, a `.` and the body, so that a request can not be replayed later
+// with a valid signature. The signature is sent hex encoded in the header `X-Pls-Signature`.
+// Returns the status code of the response, or zero if there was none, and an error unless the
+// status was 2xx.
+func sendWebhook(ctx context.Context, webhookURL string, secret uuid.UUID, deliveryID int64, event string, payload []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret.String()))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Pls-Event", event)
+	req.Header.Set("X-Pls-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Pls-Timestamp", timestamp)
+	req.Header.Set("X-Pls-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, errors.New("Responded with " + res.Status)
+	}
+	return res.StatusCode, nil
+}
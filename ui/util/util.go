@@ -1,5 +1,10 @@
 package util
 
+import "time"
+
+// Classes for text inputs, shared by the forms on all pages.
+const TextInput = "border border-gray-400 rounded outline-none focus:border-blue-400 focus:border-2 focus:-m-px px-1"
+
 func Plural(count int) string {
 	if count == 1 {
 		return ""
@@ -14,3 +19,20 @@ func If[T any](condition bool, then T, elze T) T {
 		return elze
 	}
 }
+
+// Formats a date as YYYY-MM-DD, or as the empty string if it is the zero time, which is used for
+// unset or unbounded dates.
+func FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+// Formats a date and time as YYYY-MM-DD HH:MM:SS, or as `fallback` if it is the zero time.
+func FormatTime(t time.Time, fallback string) string {
+	if t.IsZero() {
+		return fallback
+	}
+	return t.Format(time.DateTime)
+}
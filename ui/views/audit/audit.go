@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+)
+
+const pageSize = 50
+
+func RoleAuditLog(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+	filter, err := parseFilter(r)
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for before")
+	}
+	filter.RoleID = roleID
+	if ok, err := ui.MayUpdateRole(ctx, session.KTHID, roleID); err != nil {
+		slog.Error("Could not check if role may be updated", "error", err, "role_id", roleID)
+		return errors.Error(http.StatusInternalServerError)
+	} else if !ok {
+		return errors.Error(http.StatusForbidden, "You may not see the audit log of the role "+roleID)
+	}
+	return renderAuditLog(ui, ctx, "/role/"+roleID, roleID, filter)
+}
+
+func SystemAuditLog(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	systemID := r.PathValue("id")
+	filter, err := parseFilter(r)
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for before")
+	}
+	filter.SystemID = systemID
+	if ok, err := ui.MayUpdatePermissionsInSystem(ctx, session.KTHID, systemID); err != nil {
+		slog.Error("Could not check if permissions in system may be updated", "error", err, "system", systemID)
+		return errors.Error(http.StatusInternalServerError)
+	} else if !ok {
+		return errors.Error(http.StatusForbidden, "You may not see the audit log of the system "+systemID)
+	}
+	return renderAuditLog(ui, ctx, "/system/"+systemID, systemID, filter)
+}
+
+func parseFilter(r *http.Request) (service.AuditFilter, error) {
+	filter := service.AuditFilter{
+		Actor:  r.FormValue("actor"),
+		Action: r.FormValue("action"),
+		Limit:  pageSize,
+	}
+	if before := r.FormValue("before"); before != "" {
+		id, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			return filter, err
+		}
+		filter.BeforeID = id
+	}
+	return filter, nil
+}
+
+func renderAuditLog(ui *service.UI, ctx context.Context, path, title string, filter service.AuditFilter) templ.Component {
+	entries, err := ui.GetAuditLog(ctx, filter)
+	if err != nil {
+		slog.Error("Could not get audit log", "error", err, "role_id", filter.RoleID, "system", filter.SystemID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	return auditLog(path, title, entries, filter, len(entries) == pageSize)
+}
@@ -0,0 +1,18 @@
+package consistency
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+)
+
+func Consistency(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	report, err := ui.CheckConsistency(ctx, session.KTHID)
+	if err != nil {
+		return errors.Failed(err)
+	}
+	return consistency(*report)
+}
@@ -1,6 +1,8 @@
 package errors
 
 import (
+	"net/http"
+
 	"github.com/a-h/templ"
 )
 
@@ -14,3 +16,16 @@ var _ templ.Component = ErrorComponent{}
 func Error(statusCode int, messages ...string) ErrorComponent {
 	return ErrorComponent{statusCode, errorComponent(statusCode, messages...)}
 }
+
+// FailedComponent wraps an error returned by the service. It is replaced by `page` and `partial`
+// with an ErrorComponent with a status code depending on the kind of error.
+type FailedComponent struct {
+	Err error
+	templ.Component
+}
+
+var _ templ.Component = FailedComponent{}
+
+func Failed(err error) FailedComponent {
+	return FailedComponent{err, errorComponent(http.StatusInternalServerError)}
+}
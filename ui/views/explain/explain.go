@@ -0,0 +1,24 @@
+package explain
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+)
+
+func Explain(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	kthID := r.FormValue("kth-id")
+	system := r.FormValue("system")
+	permission := r.FormValue("permission")
+	if kthID == "" || system == "" || permission == "" {
+		return explain(kthID, system, permission, nil, false)
+	}
+	grants, err := ui.ExplainPermission(ctx, kthID, system, permission)
+	if err != nil {
+		return errors.Failed(err)
+	}
+	return explain(kthID, system, permission, grants, true)
+}
@@ -0,0 +1,137 @@
+package hierarchy
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/models"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+)
+
+func Hierarchy(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	h, err := ui.GetRoleHierarchy(ctx)
+	if err != nil {
+		slog.Error("Could not get role hierarchy", "error", err)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	return hierarchy(newTree(h))
+}
+
+func Export(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	h, err := ui.GetRoleHierarchy(ctx)
+	if err != nil {
+		slog.Error("Could not get role hierarchy", "error", err)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	switch format := r.FormValue("format"); format {
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="roles.dot"`)
+		return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+			return writeDOT(w, h)
+		})
+	case "json", "":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="roles.json"`)
+		return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+			return json.NewEncoder(w).Encode(h)
+		})
+	default:
+		return errors.Error(http.StatusBadRequest, "Unknown format "+format)
+	}
+}
+
+// Writes the hierarchy as a Graphviz graph with an edge from each role to its subroles.
+func writeDOT(w io.Writer, h *models.RoleHierarchy) error {
+	if _, err := fmt.Fprintln(w, "digraph roles {\n\trankdir=LR;\n\tnode [shape=box];"); err != nil {
+		return err
+	}
+	for _, role := range h.Roles {
+		if _, err := fmt.Fprintf(w, "\t%s [label=%s];\n", strconv.Quote(role.ID), strconv.Quote(role.DisplayName)); err != nil {
+			return err
+		}
+	}
+	for _, link := range h.Links {
+		if _, err := fmt.Fprintf(w, "\t%s -> %s;\n", strconv.Quote(link.SuperroleID), strconv.Quote(link.SubroleID)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// The hierarchy prepared for rendering as nested lists, starting from the roles that aren't
+// subroles of any other role. Roles with several superroles appear under each of them.
+type tree struct {
+	roles    map[string]models.Role
+	subroles map[string][]string
+	roots    []string
+}
+
+func newTree(h *models.RoleHierarchy) tree {
+	t := tree{
+		roles:    make(map[string]models.Role),
+		subroles: make(map[string][]string),
+	}
+	isSubrole := make(map[string]bool)
+	for _, role := range h.Roles {
+		t.roles[role.ID] = role
+	}
+	for _, link := range h.Links {
+		t.subroles[link.SuperroleID] = append(t.subroles[link.SuperroleID], link.SubroleID)
+		isSubrole[link.SubroleID] = true
+	}
+	byName := func(a, b string) int {
+		if c := cmp.Compare(t.roles[a].DisplayName, t.roles[b].DisplayName); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	}
+	for _, role := range h.Roles {
+		if !isSubrole[role.ID] {
+			t.roots = append(t.roots, role.ID)
+		}
+		slices.SortFunc(t.subroles[role.ID], byName)
+	}
+	slices.SortFunc(t.roots, byName)
+	// Roles in a cycle that no root leads to would otherwise not be shown at all.
+	reached := make(map[string]bool)
+	var visit func(roleID string)
+	visit = func(roleID string) {
+		if reached[roleID] {
+			return
+		}
+		reached[roleID] = true
+		for _, subroleID := range t.subroles[roleID] {
+			visit(subroleID)
+		}
+	}
+	for _, roleID := range t.roots {
+		visit(roleID)
+	}
+	for _, role := range h.Roles {
+		if !reached[role.ID] {
+			t.roots = append(t.roots, role.ID)
+			visit(role.ID)
+		}
+	}
+	return t
+}
+
+// Returns `path` with `roleID` appended, or false if `roleID` is already on the path, which only
+// happens if there is a cycle.
+func extend(path []string, roleID string) ([]string, bool) {
+	if slices.Contains(path, roleID) {
+		return nil, false
+	}
+	return append(slices.Clip(path), roleID), true
+}
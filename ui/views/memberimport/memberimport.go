@@ -0,0 +1,79 @@
+package memberimport
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/models"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+)
+
+// Requests larger than this are rejected.
+const maxUploadSize = 1 << 20
+
+func ImportPage(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	return importPage()
+}
+
+func Preview(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	return importMembers(ui, ctx, session, w, r, true)
+}
+
+func Import(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	return importMembers(ui, ctx, session, w, r, false)
+}
+
+func importMembers(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request, dryRun bool) templ.Component {
+	data, err := readData(w, r)
+	var maxBytesError *http.MaxBytesError
+	if stderrors.As(err, &maxBytesError) {
+		return errors.Error(http.StatusRequestEntityTooLarge, "The uploaded file is too large")
+	} else if err != nil {
+		return errors.Error(http.StatusBadRequest, "Could not read the uploaded file")
+	}
+	rows, err := service.ParseMemberImport(strings.NewReader(data))
+	if err != nil {
+		return errors.Failed(err)
+	}
+	results, err := ui.ImportMembers(ctx, session.KTHID, rows, dryRun)
+	if results == nil && err != nil {
+		return errors.Failed(err)
+	}
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	return preview(data, results, message, dryRun)
+}
+
+// Returns the uploaded file if there is one and otherwise the pasted text.
+func readData(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil && err != http.ErrNotMultipart {
+		return "", err
+	}
+	file, _, err := r.FormFile("file")
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return r.FormValue("data"), nil
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	return string(data), err
+}
+
+func count(results []models.MemberImportResult, change string) int {
+	n := 0
+	for _, result := range results {
+		if result.Change == change {
+			n++
+		}
+	}
+	return n
+}
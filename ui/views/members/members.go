@@ -2,8 +2,12 @@ package members
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/a-h/templ"
@@ -16,9 +20,14 @@ func GetRoleMembers(ui *service.UI, ctx context.Context, session service.Session
 	roleID := r.PathValue("id")
 	toUpdateMember, _ := uuid.Parse(r.FormValue("update-member-id"))
 	addNew := r.Form.Has("new")
-	includeExpired := r.Form.Has("include-expired")
+	period, err := service.ParseMemberPeriod(r.FormValue("period"))
+	if err != nil {
+		return errors.Failed(err)
+	}
+
+	includeIndirect := r.FormValue("include-indirect") != ""
 
-	members, err := ui.GetRoleMembers(ctx, roleID, includeExpired, true)
+	members, err := ui.GetRoleMembers(ctx, roleID, period, includeIndirect)
 	if err != nil {
 		slog.Error("Could not get members", "error", err, "role_id", roleID)
 		return errors.Error(http.StatusInternalServerError)
@@ -30,7 +39,7 @@ func GetRoleMembers(ui *service.UI, ctx context.Context, session service.Session
 		return errors.Error(http.StatusInternalServerError)
 	}
 
-	return Members(roleID, members, toUpdateMember, mayUpdate, addNew, includeExpired)
+	return Members(roleID, members, toUpdateMember, mayUpdate, addNew, period, includeIndirect)
 }
 
 func RoleAddMember(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
@@ -39,17 +48,16 @@ func RoleAddMember(ui *service.UI, ctx context.Context, session service.Session,
 	kthID := r.FormValue("kth-id")
 
 	startDate, err := time.Parse(time.DateOnly, r.FormValue("start-date"))
-	if err != nil && r.Form.Has("start-date") {
-		return errors.Error(http.StatusBadRequest)
+	if err != nil && r.FormValue("start-date") != "" {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for start date")
 	}
 	endDate, err := time.Parse(time.DateOnly, r.FormValue("end-date"))
-	if err != nil && r.Form.Has("end-date") {
-		return errors.Error(http.StatusBadRequest)
+	if err != nil && r.FormValue("end-date") != "" {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for end date")
 	}
 
-	if err := ui.AddMember(ctx, session.KTHID, roleID, kthID, startDate, endDate); err != nil {
-		slog.Error("Could not add member", "error", err, "role_id", roleID, "kth_id", kthID)
-		return errors.Error(http.StatusInternalServerError)
+	if _, err := ui.AddMember(ctx, session.KTHID, roleID, kthID, startDate, endDate); err != nil {
+		return errors.Failed(err)
 	}
 
 	return renderMembers(ui, ctx, session, roleID)
@@ -68,12 +76,11 @@ func RoleUpdateMember(ui *service.UI, ctx context.Context, session service.Sessi
 	}
 	endDate, err := time.Parse(time.DateOnly, r.FormValue("end-date"))
 	if err != nil && r.Form.Has("end-date") {
-		return errors.Error(http.StatusBadRequest, "Invalid syntax for start date")
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for end date")
 	}
 
 	if err := ui.UpdateMember(ctx, session.KTHID, roleID, memberID, startDate, endDate); err != nil {
-		slog.Error("Could not edit member", "error", err, "member", memberID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 
 	return renderMembers(ui, ctx, session, roleID)
@@ -84,8 +91,7 @@ func RoleEndMember(ui *service.UI, ctx context.Context, session service.Session,
 	member, _ := uuid.Parse(r.PathValue("memberID"))
 
 	if err := ui.UpdateMember(ctx, session.KTHID, roleID, member, time.Time{}, time.Now().AddDate(0, 0, -1)); err != nil {
-		slog.Error("Could not edit member", "error", err, "role_id", roleID, "member", member)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 
 	return renderMembers(ui, ctx, session, roleID)
@@ -96,15 +102,14 @@ func RoleRemoveMember(ui *service.UI, ctx context.Context, session service.Sessi
 	member, _ := uuid.Parse(r.PathValue("memberID"))
 
 	if err := ui.RemoveMember(ctx, session.KTHID, roleID, member); err != nil {
-		slog.Error("Could not remove member", "error", err, "member", member)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 
 	return renderMembers(ui, ctx, session, roleID)
 }
 
 func renderMembers(ui *service.UI, ctx context.Context, session service.Session, roleID string) templ.Component {
-	members, err := ui.GetRoleMembers(ctx, roleID, false, true)
+	members, err := ui.GetRoleMembers(ctx, roleID, service.CurrentMembers, true)
 	if err != nil {
 		slog.Error("Could not get members", "error", err, "role_id", roleID)
 		return errors.Error(http.StatusInternalServerError)
@@ -116,5 +121,93 @@ func renderMembers(ui *service.UI, ctx context.Context, session service.Session,
 		return errors.Error(http.StatusInternalServerError)
 	}
 
-	return Members(roleID, members, uuid.Nil, mayUpdate, false, false)
+	return Members(roleID, members, uuid.Nil, mayUpdate, false, service.CurrentMembers, true)
+}
+
+func ExportRoleMembers(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+	period, err := service.ParseMemberPeriod(r.FormValue("period"))
+	if err != nil {
+		return errors.Failed(err)
+	}
+	members, err := ui.GetRoleMembers(ctx, roleID, period, r.FormValue("include-indirect") != "")
+	if err != nil {
+		slog.Error("Could not get members", "error", err, "role_id", roleID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	header := []string{"id", "kth_id", "start_date", "end_date", "modified_by", "modified_at", "via"}
+	records := make([][]string, len(members))
+	for i, m := range members {
+		id := ""
+		if m.MemberID != uuid.Nil {
+			id = m.MemberID.String()
+		}
+		records[i] = []string{
+			id, m.KTHID, m.StartDate.Format(time.DateOnly), m.EndDate.Format(time.DateOnly),
+			m.ModifiedBy, m.ModifiedAt.Format(time.DateTime), strings.Join(m.Via, ";"),
+		}
+	}
+	return export(w, r.FormValue("format"), roleID+"-members", members, header, records)
+}
+
+func ExportMandates(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	period, err := service.ParseMemberPeriod(r.FormValue("period"))
+	if err != nil {
+		return errors.Failed(err)
+	}
+	mandates, err := ui.GetAllMandates(ctx, period)
+	if err != nil {
+		slog.Error("Could not get mandates", "error", err)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	header := []string{"role_id", "role", "kth_id", "start_date", "end_date", "modified_by", "modified_at"}
+	records := make([][]string, len(mandates))
+	for i, m := range mandates {
+		records[i] = []string{
+			m.RoleID, m.RoleDisplayName, m.KTHID,
+			m.StartDate.Format(time.DateOnly), m.EndDate.Format(time.DateOnly),
+			m.ModifiedBy, m.ModifiedAt.Format(time.DateTime),
+		}
+	}
+	return export(w, r.FormValue("format"), "mandates", mandates, header, records)
+}
+
+// Responds with either the value as json or the records as csv, as a file download.
+func export[T any](w http.ResponseWriter, format, filename string, value []T, header []string, records [][]string) templ.Component {
+	switch format {
+	case "csv", "":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		for _, record := range records {
+			for i, cell := range record {
+				record[i] = spreadsheetSafe(cell)
+			}
+		}
+		return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+			cw := csv.NewWriter(w)
+			cw.Write(header)
+			cw.WriteAll(records)
+			return cw.Error()
+		})
+	case "json":
+		if value == nil {
+			value = []T{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+			return json.NewEncoder(w).Encode(value)
+		})
+	default:
+		return errors.Error(http.StatusBadRequest, "Unknown format "+format)
+	}
+}
+
+// Prefixes values that spreadsheet programs would run as formulas with a `'`, so that they are
+// shown as text instead.
+func spreadsheetSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/datasektionen/pls4/ui/service"
@@ -18,8 +20,7 @@ func RoleAddPermission(ui *service.UI, ctx context.Context, session service.Sess
 	scope := r.FormValue("scope")
 
 	if err := ui.AddPermissionToRole(ctx, session.KTHID, roleID, system, permission, scope); err != nil {
-		slog.Error("Could add permission to role", "error", err, "role_id", roleID, "system", system, "permission", permission)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 
 	return renderPermissions(ui, ctx, session, roleID)
@@ -35,15 +36,91 @@ func RoleRemovePermission(ui *service.UI, ctx context.Context, session service.S
 	// don't rely on that for authorization
 
 	if err := ui.RemovePermission(ctx, session.KTHID, instanceID); err != nil {
-		slog.Error("Could remove permission from role", "error", err, "role_id", roleID, "instance_id", instanceID)
+		return errors.Failed(err)
+	}
+
+	return renderPermissions(ui, ctx, session, roleID)
+}
+
+func RolePermissionDatesForm(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+	instanceID, err := uuid.Parse(r.PathValue("instanceID"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	perms, err := ui.GetRolePermissions(ctx, roleID)
+	if err != nil {
+		slog.Error("Could not get role permissions", "error", err, "role_id", roleID)
 		return errors.Error(http.StatusInternalServerError)
 	}
+	for _, sysPerm := range perms {
+		for _, perm := range sysPerm.Permissions {
+			if perm.ID == instanceID {
+				return permissionDatesForm("/role/"+roleID, perm)
+			}
+		}
+	}
+	return errors.Error(http.StatusNotFound, "No such permission instance")
+}
+
+func RoleUpdatePermissionDates(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+	instanceID, err := uuid.Parse(r.PathValue("instanceID"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	startDate, err := time.Parse(time.DateOnly, r.FormValue("start-date"))
+	if err != nil && r.FormValue("start-date") != "" {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for start date")
+	}
+	endDate, err := time.Parse(time.DateOnly, r.FormValue("end-date"))
+	if err != nil && r.FormValue("end-date") != "" {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for end date")
+	}
+
+	if err := ui.UpdatePermissionDates(ctx, session.KTHID, roleID, instanceID, startDate, endDate); err != nil {
+		return errors.Failed(err)
+	}
 
 	return renderPermissions(ui, ctx, session, roleID)
 }
 
+func TokenAddPermission(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	tokenID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	system := r.FormValue("system")
+	permission := r.FormValue("permission")
+	scope := r.FormValue("scope")
+
+	if err := ui.AddPermissionToToken(ctx, session.KTHID, tokenID, system, permission, scope); err != nil {
+		return errors.Failed(err)
+	}
+
+	return RenderTokenPermissions(ui, ctx, session, tokenID)
+}
+
+func TokenRemovePermission(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	tokenID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	instanceID, err := uuid.Parse(r.PathValue("instanceID"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+
+	if err := ui.RemoveTokenPermission(ctx, session.KTHID, tokenID, instanceID); err != nil {
+		return errors.Failed(err)
+	}
+
+	return RenderTokenPermissions(ui, ctx, session, tokenID)
+}
+
+// Used for both roles and tokens, so the form posts back to the path it was requested from.
 func AddPermissionForm(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
-	roleID := r.PathValue("id")
+	path := strings.TrimSuffix(r.URL.Path, "/add-permission-form")
 
 	systemSet, err := ui.MayUpdatePermissionsInSystems(ctx, session.KTHID)
 	if err != nil {
@@ -54,7 +131,7 @@ func AddPermissionForm(ui *service.UI, ctx context.Context, session service.Sess
 		systems = append(systems, system)
 	}
 
-	return roleAddPermissionForm(roleID, systems)
+	return addPermissionForm(path, systems)
 }
 
 func PermissionSelect(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
@@ -62,8 +139,7 @@ func PermissionSelect(ui *service.UI, ctx context.Context, session service.Sessi
 
 	permissions, err := ui.GetPermissions(r.Context(), system)
 	if err != nil {
-		slog.Error("Could not get permissions for system", "error", err, "system", system)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	permissionIDs := make([]string, len(permissions))
 	for i, perm := range permissions {
@@ -107,5 +183,36 @@ func renderPermissions(ui *service.UI, ctx context.Context, session service.Sess
 		return errors.Error(http.StatusInternalServerError)
 	}
 
-	return Permissions(roleID, perms, mayAddPermissions, mayDeleteInSystems)
+	return Permissions("/role/"+roleID, true, perms, mayAddPermissions, mayDeleteInSystems)
+}
+
+func RenderTokenPermissions(ui *service.UI, ctx context.Context, session service.Session, tokenID uuid.UUID) templ.Component {
+	perms, err := ui.GetTokenPermissions(ctx, tokenID)
+	if err != nil {
+		slog.Error("Could not get token permissions", "error", err, "token_id", tokenID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+
+	mayAddPermissions, err := ui.MayAddPermissions(ctx, session.KTHID)
+	if err != nil {
+		slog.Error("Could not filter systems for permissions", "error", err)
+		return errors.Error(http.StatusInternalServerError)
+	}
+
+	var systems []string
+	for _, perm := range perms {
+		systems = append(systems, perm.System)
+	}
+	mayDeleteInSystems, err := ui.MayUpdatePermissionsInSystems(ctx, session.KTHID, systems)
+	if err != nil {
+		slog.Error("Could not filter systems for permissions", "error", err)
+		return errors.Error(http.StatusInternalServerError)
+	}
+
+	return Permissions("/token/"+tokenID.String(), false, perms, mayAddPermissions, mayDeleteInSystems)
+}
+
+func contains(set map[string]struct{}, key string) bool {
+	_, ok := set[key]
+	return ok
 }
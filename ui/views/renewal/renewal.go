@@ -0,0 +1,67 @@
+package renewal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+	"github.com/google/uuid"
+)
+
+func RenewPage(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	role, err := ui.GetRole(ctx, r.PathValue("id"))
+	if err != nil {
+		return errors.Failed(err)
+	}
+	mandates, err := ui.GetRenewableMandates(ctx, role.ID, false)
+	if err != nil {
+		return errors.Failed(err)
+	}
+	endDate := termEnd(time.Now())
+	return renewPage(*role, mandates, endDate, endDate.AddDate(1, 0, 0))
+}
+
+func RenewableMandates(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	mandates, err := ui.GetRenewableMandates(ctx, r.PathValue("id"), r.FormValue("include-subroles") != "")
+	if err != nil {
+		return errors.Failed(err)
+	}
+	return mandateList(mandates)
+}
+
+func Renew(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+	endDate, err := time.Parse(time.DateOnly, r.FormValue("end-date"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for end date")
+	}
+	nextEndDate, err := time.Parse(time.DateOnly, r.FormValue("next-end-date"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for end date of the next term")
+	}
+	var renew []uuid.UUID
+	for _, s := range r.Form["renew"] {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return errors.Error(http.StatusBadRequest, "Invalid member id "+s)
+		}
+		renew = append(renew, id)
+	}
+	count, err := ui.RenewMandates(ctx, session.KTHID, roleID, r.FormValue("include-subroles") != "", endDate, nextEndDate, renew)
+	if err != nil {
+		return errors.Failed(err)
+	}
+	return renewed(roleID, count, endDate)
+}
+
+// Returns the last day of the term that is running at `now`, where terms end on the 30th of June.
+func termEnd(now time.Time) time.Time {
+	year := now.Year()
+	if now.Month() > time.June {
+		year++
+	}
+	return time.Date(year, time.June, 30, 0, 0, 0, 0, time.UTC)
+}
@@ -18,18 +18,19 @@ func GetRole(ui *service.UI, ctx context.Context, session service.Session, w htt
 	roleID := r.PathValue("id")
 	role, err := ui.GetRole(ctx, roleID)
 	if err != nil {
-		slog.Error("Could not get role", "error", err, "role_id", roleID)
-		return errors.Error(http.StatusInternalServerError)
-	}
-	if role == nil {
-		return errors.Error(http.StatusNotFound, "No role with id "+roleID)
+		return errors.Failed(err)
 	}
 	subroles, err := ui.GetSubroles(ctx, roleID)
 	if err != nil {
 		slog.Error("Could not get subroles", "error", err, "role_id", roleID)
 		return errors.Error(http.StatusInternalServerError)
 	}
-	members, err := ui.GetRoleMembers(ctx, roleID, false, true)
+	superroles, err := ui.GetSuperroles(ctx, roleID)
+	if err != nil {
+		slog.Error("Could not get superroles", "error", err, "role_id", roleID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	members, err := ui.GetRoleMembers(ctx, roleID, service.CurrentMembers, true)
 	if err != nil {
 		slog.Error("Could not get role members", "error", err, "role_id", roleID)
 		return errors.Error(http.StatusInternalServerError)
@@ -39,6 +40,11 @@ func GetRole(ui *service.UI, ctx context.Context, session service.Session, w htt
 		slog.Error("Could not get role permissions", "error", err, "role_id", roleID)
 		return errors.Error(http.StatusInternalServerError)
 	}
+	inherited, err := ui.GetInheritedPermissions(ctx, roleID)
+	if err != nil {
+		slog.Error("Could not get inherited permissions", "error", err, "role_id", roleID)
+		return errors.Error(http.StatusInternalServerError)
+	}
 	mayUpdate, err := ui.MayUpdateRole(ctx, session.KTHID, roleID)
 	if err != nil {
 		slog.Error("Could not check if role may be updated", "error", err, "role_id", roleID)
@@ -57,7 +63,13 @@ func GetRole(ui *service.UI, ctx context.Context, session service.Session, w htt
 	}
 	mayDeleteInSystems, err := ui.MayUpdatePermissionsInSystems(ctx, session.KTHID, systems)
 
-	return roleComponent(*role, subroles, members, permissions, mayUpdate, mayAddPermissions, mayDeleteInSystems)
+	notifyExpiry, err := ui.GetExpiryNotifications(ctx, roleID)
+	if err != nil {
+		slog.Error("Could not get expiry notification setting", "error", err, "role_id", roleID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+
+	return roleComponent(*role, superroles, subroles, members, permissions, inherited, notifyExpiry, mayUpdate, mayAddPermissions, mayDeleteInSystems)
 }
 
 func CreateRoleForm(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
@@ -75,8 +87,7 @@ func CreateRole(ui *service.UI, ctx context.Context, session service.Session, w
 	description := r.FormValue("description")
 	owner := r.FormValue("owner")
 	if err := ui.CreateRole(ctx, session.KTHID, roleID, displayName, description, owner); err != nil {
-		slog.Error("Could not create role", "error", err, "role_id", roleID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 
 	return renderRoles(ui, ctx, session)
@@ -85,8 +96,7 @@ func CreateRole(ui *service.UI, ctx context.Context, session service.Session, w
 func DeleteRole(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
 	roleID := r.PathValue("id")
 	if err := ui.DeleteRole(ctx, session.KTHID, roleID); err != nil {
-		slog.Error("Could not delete role", "error", err, "role_id", roleID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 
 	return renderRoles(ui, ctx, session)
@@ -97,11 +107,7 @@ func RoleNameForm(ui *service.UI, ctx context.Context, session service.Session,
 
 	role, err := ui.GetRole(r.Context(), roleID)
 	if err != nil {
-		slog.Error("Could not get role", "error", err, "role_id", roleID)
-		return errors.Error(http.StatusInternalServerError)
-	}
-	if role == nil {
-		return errors.Error(http.StatusNotFound, "No role with id "+roleID)
+		return errors.Failed(err)
 	}
 	return roleNameForm(*role)
 }
@@ -111,8 +117,7 @@ func UpdateRoleName(ui *service.UI, ctx context.Context, session service.Session
 
 	displayName := r.FormValue("display-name")
 	if err := ui.UpdateRole(r.Context(), session.KTHID, roleID, displayName, ""); err != nil {
-		slog.Error("Could not update role name", "error", err)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	return roleNameDisplay(roleID, displayName, true)
 }
@@ -122,11 +127,7 @@ func RoleDescriptionForm(ui *service.UI, ctx context.Context, session service.Se
 
 	role, err := ui.GetRole(r.Context(), roleID)
 	if err != nil {
-		slog.Error("Could not get role", "error", err, "role_id", roleID)
-		return errors.Error(http.StatusInternalServerError)
-	}
-	if role == nil {
-		return errors.Error(http.StatusNotFound, "No role with id "+roleID)
+		return errors.Failed(err)
 	}
 	return roleDescriptionForm(*role)
 }
@@ -136,12 +137,21 @@ func UpdateRoleDescription(ui *service.UI, ctx context.Context, session service.
 
 	description := r.FormValue("description")
 	if err := ui.UpdateRole(r.Context(), session.KTHID, roleID, "", description); err != nil {
-		slog.Error("Could not update role description", "error", err)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	return roleDescriptionDisplay(roleID, description, true)
 }
 
+func UpdateExpiryNotifications(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+
+	enabled := r.FormValue("notify-expiry") != ""
+	if err := ui.SetExpiryNotifications(ctx, session.KTHID, roleID, enabled); err != nil {
+		return errors.Failed(err)
+	}
+	return expiryNotifications(roleID, enabled, true)
+}
+
 func renderRoles(ui *service.UI, ctx context.Context, session service.Session) templ.Component {
 	roles, err := ui.ListRoles(ctx)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/datasektionen/pls4/ui/service"
@@ -24,11 +25,46 @@ func RoleSubroleForm(ui *service.UI, ctx context.Context, session service.Sessio
 func RoleAddSubrole(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
 	roleID := r.PathValue("id")
 	subrole := r.FormValue("subrole")
+	startDate, endDate, err := parseDates(r)
+	if err != nil {
+		return err
+	}
+
+	if err := ui.AddSubrole(ctx, session.KTHID, roleID, subrole, startDate, endDate); err != nil {
+		return errors.Failed(err)
+	}
+
+	return renderSubroles(ui, ctx, session, roleID)
+}
 
-	if err := ui.AddSubrole(ctx, session.KTHID, roleID, subrole); err != nil {
-		slog.Error("Could not add subrole", "error", err, "role_id", roleID, "subrole_id", subrole)
+func RoleSubroleDatesForm(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+	subroleID := r.PathValue("subroleID")
+
+	subroles, err := ui.GetSubroles(ctx, roleID)
+	if err != nil {
+		slog.Error("Could not get subroles", "error", err, "role_id", roleID)
 		return errors.Error(http.StatusInternalServerError)
 	}
+	for _, subrole := range subroles {
+		if subrole.ID == subroleID {
+			return subroleDatesForm(roleID, subrole)
+		}
+	}
+	return errors.Error(http.StatusNotFound, "The role "+subroleID+" is not a subrole of "+roleID)
+}
+
+func RoleUpdateSubroleDates(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	roleID := r.PathValue("id")
+	subroleID := r.PathValue("subroleID")
+	startDate, endDate, err := parseDates(r)
+	if err != nil {
+		return err
+	}
+
+	if err := ui.UpdateSubroleDates(ctx, session.KTHID, roleID, subroleID, &startDate, &endDate); err != nil {
+		return errors.Failed(err)
+	}
 
 	return renderSubroles(ui, ctx, session, roleID)
 }
@@ -38,8 +74,7 @@ func RoleRemoveSubrole(ui *service.UI, ctx context.Context, session service.Sess
 	subroleID := r.PathValue("subroleID")
 
 	if err := ui.RemoveSubrole(ctx, session.KTHID, roleID, subroleID); err != nil {
-		slog.Error("Could not remove subrole", "error", err, "role_id", roleID, "subrole_id", subroleID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 
 	return renderSubroles(ui, ctx, session, roleID)
@@ -59,3 +94,16 @@ func renderSubroles(ui *service.UI, ctx context.Context, session service.Session
 	return Subroles(roleID, subroles, mayUpdate)
 }
 
+// Parses the optional start and end dates of a subrole link. The returned component is an error to
+// respond with, if any.
+func parseDates(r *http.Request) (time.Time, time.Time, templ.Component) {
+	startDate, err := time.Parse(time.DateOnly, r.FormValue("start-date"))
+	if err != nil && r.FormValue("start-date") != "" {
+		return time.Time{}, time.Time{}, errors.Error(http.StatusBadRequest, "Invalid syntax for start date")
+	}
+	endDate, err := time.Parse(time.DateOnly, r.FormValue("end-date"))
+	if err != nil && r.FormValue("end-date") != "" {
+		return time.Time{}, time.Time{}, errors.Error(http.StatusBadRequest, "Invalid syntax for end date")
+	}
+	return startDate, endDate, nil
+}
@@ -29,8 +29,7 @@ func GetSystem(ui *service.UI, ctx context.Context, session service.Session, w h
 	systemID := r.PathValue("id")
 	permissions, err := ui.GetPermissions(ctx, systemID)
 	if err != nil {
-		slog.Error("Could not get permissions for system", "error", err, "system", systemID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	mayUpdate, err := ui.MayUpdatePermissionsInSystem(ctx, session.KTHID, systemID)
 	if err != nil {
@@ -43,8 +42,7 @@ func GetSystem(ui *service.UI, ctx context.Context, session service.Session, w h
 func CreateSystem(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
 	systemID := r.FormValue("system-id")
 	if err := ui.CreateSystem(ctx, systemID, session.KTHID); err != nil {
-		slog.Error("Could not create system", "error", err, "system", systemID, "kth_id", session.KTHID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	mayDelete, err := ui.MayDeleteSystems(ctx, session.KTHID)
 	if err != nil {
@@ -57,8 +55,7 @@ func CreateSystem(ui *service.UI, ctx context.Context, session service.Session,
 func DeleteSystem(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
 	systemID := r.PathValue("id")
 	if err := ui.DeleteSystem(ctx, systemID, session.KTHID); err != nil {
-		slog.Error("Could not delete system", "error", err, "system", systemID, "kth_id", session.KTHID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	return nil
 }
@@ -68,8 +65,7 @@ func CreatePermission(ui *service.UI, ctx context.Context, session service.Sessi
 	permissionID := r.FormValue("permission-id")
 	hasScope := r.Form.Has("has-scope")
 	if err := ui.CreatePermission(ctx, systemID, permissionID, hasScope, session.KTHID); err != nil {
-		slog.Error("Could not delete system", "error", err, "system", systemID, "kth_id", session.KTHID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	mayUpdate, err := ui.MayUpdatePermissionsInSystem(ctx, session.KTHID, systemID)
 	if err != nil {
@@ -83,8 +79,7 @@ func DeletePermission(ui *service.UI, ctx context.Context, session service.Sessi
 	systemID := r.PathValue("id")
 	permissionID := r.PathValue("permissionID")
 	if err := ui.DeletePermission(ctx, systemID, permissionID, session.KTHID); err != nil {
-		slog.Error("Could not delete permission", "error", err, "system", systemID, "permission", permissionID, "kth_id", session.KTHID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	return nil
 }
@@ -94,8 +89,7 @@ func AddScopeToPermission(ui *service.UI, ctx context.Context, session service.S
 	permissionID := r.PathValue("permissionID")
 	defaultScope := r.Header.Get("hx-prompt")
 	if err := ui.AddScopeToPermission(ctx, systemID, permissionID, defaultScope, session.KTHID); err != nil {
-		slog.Error("Could not add scope to permission", "error", err, "system", systemID, "permission", permissionID, "kth_id", session.KTHID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	mayUpdate, err := ui.MayUpdatePermissionsInSystem(ctx, session.KTHID, systemID)
 	if err != nil {
@@ -109,8 +103,7 @@ func RemoveScopeFromPermission(ui *service.UI, ctx context.Context, session serv
 	systemID := r.PathValue("id")
 	permissionID := r.PathValue("permissionID")
 	if err := ui.RemoveScopeFromPermission(ctx, systemID, permissionID, session.KTHID); err != nil {
-		slog.Error("Could not remove scope from permission", "error", err, "system", systemID, "permission", permissionID, "kth_id", session.KTHID)
-		return errors.Error(http.StatusInternalServerError)
+		return errors.Failed(err)
 	}
 	mayUpdate, err := ui.MayUpdatePermissionsInSystem(ctx, session.KTHID, systemID)
 	if err != nil {
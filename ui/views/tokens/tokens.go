@@ -0,0 +1,99 @@
+package tokens
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+	"github.com/datasektionen/pls4/ui/views/permissions"
+	"github.com/google/uuid"
+)
+
+func ListTokens(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	return renderTokens(ui, ctx, session, uuid.Nil, uuid.Nil)
+}
+
+func GetToken(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	tokenID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	mayManage, err := ui.MayManageTokens(ctx, session.KTHID)
+	if err != nil {
+		slog.Error("Could not check if user may manage api tokens", "error", err, "kth_id", session.KTHID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	if !mayManage {
+		return errors.Error(http.StatusForbidden, "You may not manage api tokens")
+	}
+	token, err := ui.GetToken(ctx, tokenID)
+	if err != nil {
+		return errors.Failed(err)
+	}
+	return tokenComponent(*token, permissions.RenderTokenPermissions(ui, ctx, session, tokenID))
+}
+
+func CreateToken(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	description := r.FormValue("description")
+	expiresAt, err := time.Parse(time.DateOnly, r.FormValue("expires-at"))
+	if err != nil && r.FormValue("expires-at") != "" {
+		return errors.Error(http.StatusBadRequest, "Invalid syntax for expiry date")
+	}
+
+	secret, err := ui.CreateToken(ctx, session.KTHID, description, expiresAt)
+	if err != nil {
+		return errors.Failed(err)
+	}
+
+	return renderTokens(ui, ctx, session, uuid.Nil, secret)
+}
+
+func RotateToken(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	tokenID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+
+	secret, err := ui.RotateToken(ctx, session.KTHID, tokenID)
+	if err != nil {
+		return errors.Failed(err)
+	}
+
+	return renderTokens(ui, ctx, session, tokenID, secret)
+}
+
+func DeleteToken(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	tokenID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+
+	if err := ui.DeleteToken(ctx, session.KTHID, tokenID); err != nil {
+		return errors.Failed(err)
+	}
+
+	return renderTokens(ui, ctx, session, uuid.Nil, uuid.Nil)
+}
+
+// Renders the list of tokens. If `secret` is not uuid.Nil it is shown once, together with the
+// token it belongs to, or as a new token if `tokenID` is uuid.Nil.
+func renderTokens(ui *service.UI, ctx context.Context, session service.Session, tokenID, secret uuid.UUID) templ.Component {
+	mayManage, err := ui.MayManageTokens(ctx, session.KTHID)
+	if err != nil {
+		slog.Error("Could not check if user may manage api tokens", "error", err, "kth_id", session.KTHID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	if !mayManage {
+		return errors.Error(http.StatusForbidden, "You may not manage api tokens")
+	}
+	tokens, err := ui.ListTokens(ctx)
+	if err != nil {
+		slog.Error("Could not list api tokens", "error", err)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	return tokenList(tokens, tokenID, secret)
+}
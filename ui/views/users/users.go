@@ -0,0 +1,42 @@
+package users
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+)
+
+func GetUser(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	kthID := r.PathValue("kthID")
+	current, err := ui.GetUserMandates(ctx, kthID, service.CurrentMembers)
+	if err != nil {
+		slog.Error("Could not get user mandates", "error", err, "kth_id", kthID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	future, err := ui.GetUserMandates(ctx, kthID, service.UpcomingMembers)
+	if err != nil {
+		slog.Error("Could not get user mandates", "error", err, "kth_id", kthID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	past, err := ui.GetUserMandates(ctx, kthID, service.ExpiredMembers)
+	if err != nil {
+		slog.Error("Could not get user mandates", "error", err, "kth_id", kthID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	roles, err := ui.GetUserRoles(ctx, kthID)
+	if err != nil {
+		slog.Error("Could not get user roles", "error", err, "kth_id", kthID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	permissions, err := ui.GetUserPermissions(ctx, kthID)
+	if err != nil {
+		slog.Error("Could not get user permissions", "error", err, "kth_id", kthID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+
+	return user(kthID, current, future, past, roles, permissions)
+}
@@ -3,6 +3,7 @@ package views
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -10,12 +11,21 @@ import (
 
 	"github.com/a-h/templ"
 	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/audit"
+	"github.com/datasektionen/pls4/ui/views/consistency"
 	"github.com/datasektionen/pls4/ui/views/errors"
+	"github.com/datasektionen/pls4/ui/views/explain"
+	"github.com/datasektionen/pls4/ui/views/hierarchy"
+	"github.com/datasektionen/pls4/ui/views/memberimport"
 	"github.com/datasektionen/pls4/ui/views/members"
 	"github.com/datasektionen/pls4/ui/views/permissions"
+	"github.com/datasektionen/pls4/ui/views/renewal"
 	"github.com/datasektionen/pls4/ui/views/roles"
 	"github.com/datasektionen/pls4/ui/views/subroles"
 	"github.com/datasektionen/pls4/ui/views/systems"
+	"github.com/datasektionen/pls4/ui/views/tokens"
+	"github.com/datasektionen/pls4/ui/views/users"
+	"github.com/datasektionen/pls4/ui/views/webhooks"
 )
 
 //go:generate templ generate
@@ -28,30 +38,47 @@ func Mount(mux *http.ServeMux, ui *service.UI) {
 	mux.Handle("POST /role", partial(ui, roles.CreateRole))
 	mux.Handle("DELETE /role/{id}", partial(ui, roles.DeleteRole))
 
+	mux.Handle("GET /role/{id}/audit", page(ui, audit.RoleAuditLog))
+
+	mux.Handle("GET /hierarchy", page(ui, hierarchy.Hierarchy))
+	mux.Handle("GET /hierarchy/export", partial(ui, hierarchy.Export))
+
 	mux.Handle("GET /role/{id}/name", partial(ui, roles.RoleNameForm))
 	mux.Handle("POST /role/{id}/name", partial(ui, roles.UpdateRoleName))
 
 	mux.Handle("GET /role/{id}/description", partial(ui, roles.RoleDescriptionForm))
 	mux.Handle("POST /role/{id}/description", partial(ui, roles.UpdateRoleDescription))
+	mux.Handle("POST /role/{id}/notify-expiry", partial(ui, roles.UpdateExpiryNotifications))
 
 	mux.Handle("GET /role/{id}/subrole", partial(ui, subroles.RoleSubroleForm))
 	mux.Handle("POST /role/{id}/subrole", partial(ui, subroles.RoleAddSubrole))
 	mux.Handle("DELETE /role/{id}/subrole/{subroleID}", partial(ui, subroles.RoleRemoveSubrole))
+	mux.Handle("GET /role/{id}/subrole/{subroleID}/dates", partial(ui, subroles.RoleSubroleDatesForm))
+	mux.Handle("POST /role/{id}/subrole/{subroleID}/dates", partial(ui, subroles.RoleUpdateSubroleDates))
 
 	mux.Handle("GET /role/{id}/member", partial(ui, members.GetRoleMembers))
+	mux.Handle("GET /role/{id}/member/export", partial(ui, members.ExportRoleMembers))
+	mux.Handle("GET /mandates/export", partial(ui, members.ExportMandates))
 	mux.Handle("POST /role/{id}/member", partial(ui, members.RoleAddMember))
 	mux.Handle("POST /role/{id}/member/{memberID}", partial(ui, members.RoleUpdateMember))
 	mux.Handle("POST /role/{id}/member/{memberID}/end", partial(ui, members.RoleEndMember))
 	mux.Handle("DELETE /role/{id}/member/{memberID}", partial(ui, members.RoleRemoveMember))
 
+	mux.Handle("GET /role/{id}/renew", page(ui, renewal.RenewPage))
+	mux.Handle("GET /role/{id}/renew/mandates", partial(ui, renewal.RenewableMandates))
+	mux.Handle("POST /role/{id}/renew", partial(ui, renewal.Renew))
+
 	mux.Handle("POST /role/{id}/permission", partial(ui, permissions.RoleAddPermission))
 	mux.Handle("DELETE /role/{id}/permission/{instanceID}", partial(ui, permissions.RoleRemovePermission))
+	mux.Handle("GET /role/{id}/permission/{instanceID}/dates", partial(ui, permissions.RolePermissionDatesForm))
+	mux.Handle("POST /role/{id}/permission/{instanceID}/dates", partial(ui, permissions.RoleUpdatePermissionDates))
 	mux.Handle("GET /role/{id}/add-permission-form", partial(ui, permissions.AddPermissionForm))
 	mux.Handle("GET /permission-select", partial(ui, permissions.PermissionSelect))
 	mux.Handle("GET /scope-input", partial(ui, permissions.ScopeInput))
 
 	mux.Handle("GET /system", page(ui, systems.ListSystems))
 	mux.Handle("GET /system/{id}", page(ui, systems.GetSystem))
+	mux.Handle("GET /system/{id}/audit", page(ui, audit.SystemAuditLog))
 	mux.Handle("POST /system", partial(ui, systems.CreateSystem))
 	mux.Handle("DELETE /system/{id}", partial(ui, systems.DeleteSystem))
 	mux.Handle("POST /system/{id}/permission", partial(ui, systems.CreatePermission))
@@ -59,6 +86,29 @@ func Mount(mux *http.ServeMux, ui *service.UI) {
 	mux.Handle("POST /system/{id}/permission/{permissionID}/scope", partial(ui, systems.AddScopeToPermission))
 	mux.Handle("DELETE /system/{id}/permission/{permissionID}/scope", partial(ui, systems.RemoveScopeFromPermission))
 
+	mux.Handle("GET /import", page(ui, memberimport.ImportPage))
+	mux.Handle("POST /import/preview", partial(ui, memberimport.Preview))
+	mux.Handle("POST /import", partial(ui, memberimport.Import))
+
+	mux.Handle("GET /user/{kthID}", page(ui, users.GetUser))
+	mux.Handle("GET /explain", page(ui, explain.Explain))
+	mux.Handle("GET /consistency", page(ui, consistency.Consistency))
+
+	mux.Handle("GET /token", page(ui, tokens.ListTokens))
+	mux.Handle("POST /token", partial(ui, tokens.CreateToken))
+	mux.Handle("POST /token/{id}/rotate", partial(ui, tokens.RotateToken))
+	mux.Handle("DELETE /token/{id}", partial(ui, tokens.DeleteToken))
+	mux.Handle("GET /token/{id}", page(ui, tokens.GetToken))
+	mux.Handle("POST /token/{id}/permission", partial(ui, permissions.TokenAddPermission))
+	mux.Handle("DELETE /token/{id}/permission/{instanceID}", partial(ui, permissions.TokenRemovePermission))
+	mux.Handle("GET /token/{id}/add-permission-form", partial(ui, permissions.AddPermissionForm))
+
+	mux.Handle("GET /webhook", page(ui, webhooks.ListWebhooks))
+	mux.Handle("POST /webhook", partial(ui, webhooks.CreateWebhook))
+	mux.Handle("DELETE /webhook/{id}", partial(ui, webhooks.DeleteWebhook))
+	mux.Handle("GET /webhook/{id}", page(ui, webhooks.GetWebhook))
+	mux.Handle("POST /webhook/{id}/delivery/{deliveryID}/retry", partial(ui, webhooks.RetryDelivery))
+
 	mux.Handle("/login", route(ui, login))
 	mux.Handle("/login-callback", route(ui, loginCallback))
 	mux.Handle("/logout", route(ui, logout))
@@ -108,7 +158,7 @@ func page(ui *service.UI, handler func(ui *service.UI, ctx context.Context, sess
 			return
 		}
 
-		component := handler(ui, ctx, session, w, r)
+		component := failureToError(r, handler(ui, ctx, session, w, r))
 		if e, ok := component.(errors.ErrorComponent); ok {
 			w.WriteHeader(e.Code)
 		}
@@ -137,7 +187,12 @@ func partial(ui *service.UI, handler func(ui *service.UI, ctx context.Context, s
 			// Empty response
 			return
 		}
+		component = failureToError(r, component)
 		if e, ok := component.(errors.ErrorComponent); ok {
+			// Show the error in the dedicated element instead of where the content would have
+			// gone.
+			w.Header().Set("hx-retarget", "#error")
+			w.Header().Set("hx-reswap", "innerHTML")
 			w.WriteHeader(e.Code)
 		}
 		if err := component.Render(ctx, w); err != nil {
@@ -147,6 +202,28 @@ func partial(ui *service.UI, handler func(ui *service.UI, ctx context.Context, s
 	}
 }
 
+var statusCodes = map[service.ErrorKind]int{
+	service.Forbidden: http.StatusForbidden,
+	service.NotFound:  http.StatusNotFound,
+	service.Conflict:  http.StatusConflict,
+	service.Invalid:   http.StatusBadRequest,
+}
+
+// Replaces a failed component with an error component with a status code and message based on the
+// error returned by the service. Other components are returned as is.
+func failureToError(r *http.Request, component templ.Component) templ.Component {
+	failed, ok := component.(errors.FailedComponent)
+	if !ok {
+		return component
+	}
+	var serviceError *service.Error
+	if stderrors.As(failed.Err, &serviceError) {
+		return errors.Error(statusCodes[serviceError.Kind], serviceError.Message)
+	}
+	slog.Error("Request failed", "error", failed.Err, "method", r.Method, "path", r.URL.Path)
+	return errors.Error(http.StatusInternalServerError)
+}
+
 func login(ui *service.UI, w http.ResponseWriter, r *http.Request) {
 	returnURL := r.URL.Query().Get("return-url")
 	host := r.Host
@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/a-h/templ"
+	"github.com/datasektionen/pls4/models"
+	"github.com/datasektionen/pls4/ui/service"
+	"github.com/datasektionen/pls4/ui/views/errors"
+	"github.com/google/uuid"
+)
+
+// How many deliveries to show on the page of a webhook.
+const deliveryLimit = 100
+
+func ListWebhooks(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	return renderWebhooks(ui, ctx, session, uuid.Nil)
+}
+
+func CreateWebhook(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	secret, err := ui.CreateWebhook(ctx, session.KTHID, r.FormValue("url"), r.FormValue("description"), r.Form["event"])
+	if err != nil {
+		return errors.Failed(err)
+	}
+	return renderWebhooks(ui, ctx, session, secret)
+}
+
+func DeleteWebhook(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	webhookID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	if err := ui.DeleteWebhook(ctx, session.KTHID, webhookID); err != nil {
+		return errors.Failed(err)
+	}
+	return renderWebhooks(ui, ctx, session, uuid.Nil)
+}
+
+func GetWebhook(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	webhookID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	if c := checkMayManage(ui, ctx, session); c != nil {
+		return c
+	}
+	webhook, err := ui.GetWebhook(ctx, webhookID)
+	if err != nil {
+		return errors.Failed(err)
+	}
+	deliveries, err := ui.GetWebhookDeliveries(ctx, webhookID, deliveryLimit)
+	if err != nil {
+		slog.Error("Could not get webhook deliveries", "error", err, "webhook_id", webhookID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	return webhookComponent(*webhook, deliveries)
+}
+
+func RetryDelivery(ui *service.UI, ctx context.Context, session service.Session, w http.ResponseWriter, r *http.Request) templ.Component {
+	webhookID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid uuid syntax")
+	}
+	deliveryID, err := strconv.ParseInt(r.PathValue("deliveryID"), 10, 64)
+	if err != nil {
+		return errors.Error(http.StatusBadRequest, "Invalid delivery id")
+	}
+	if err := ui.RetryWebhookDelivery(ctx, session.KTHID, webhookID, deliveryID); err != nil {
+		return errors.Failed(err)
+	}
+	deliveries, err := ui.GetWebhookDeliveries(ctx, webhookID, deliveryLimit)
+	if err != nil {
+		slog.Error("Could not get webhook deliveries", "error", err, "webhook_id", webhookID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	return deliveryList(webhookID, deliveries)
+}
+
+// Returns an error to show if the user may not manage webhooks, and otherwise nil.
+func checkMayManage(ui *service.UI, ctx context.Context, session service.Session) templ.Component {
+	mayManage, err := ui.MayManageWebhooks(ctx, session.KTHID)
+	if err != nil {
+		slog.Error("Could not check if user may manage webhooks", "error", err, "kth_id", session.KTHID)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	if !mayManage {
+		return errors.Error(http.StatusForbidden, "You may not manage webhooks")
+	}
+	return nil
+}
+
+// Renders the list of webhooks. If `secret` is not uuid.Nil it is shown once, as the secret of a
+// newly created webhook.
+func renderWebhooks(ui *service.UI, ctx context.Context, session service.Session, secret uuid.UUID) templ.Component {
+	if c := checkMayManage(ui, ctx, session); c != nil {
+		return c
+	}
+	webhooks, err := ui.ListWebhooks(ctx)
+	if err != nil {
+		slog.Error("Could not list webhooks", "error", err)
+		return errors.Error(http.StatusInternalServerError)
+	}
+	return webhookList(webhooks, secret)
+}
+
+func givenUp(d models.WebhookDelivery) bool {
+	return d.DeliveredAt.IsZero() && d.Attempts >= service.MaxWebhookAttempts
+}